@@ -1,78 +1,84 @@
 package auth
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	"io/ioutil"
 	"recipe-api/models"
 	"recipe-api/storage"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"gopkg.in/yaml.v2"
 )
 
 // AuthService handles authentication operations
 type AuthService struct {
-	config       *models.Config
+	settings     atomic.Pointer[authSettings]
 	userStorage  storage.UserStorage
 	activeTokens map[string]*TokenInfo
 	mutex        sync.RWMutex
 }
 
+// authSettings are the settings of an AuthService that can be changed while
+// it runs. They are replaced as a whole, never modified in place.
+type authSettings struct {
+	secret      []byte
+	tokenExpiry time.Duration
+
+	// previousSecret is the secret replaced by the last rotation. Share
+	// tokens signed with it are still accepted until previousUntil.
+	previousSecret []byte
+	previousUntil  time.Time
+}
+
 // TokenInfo stores information about an active token
 type TokenInfo struct {
 	Username  string
 	UserID    int
+	IsAdmin   bool
 	CreatedAt time.Time
 	ExpiresAt time.Time
 }
 
 // NewAuthService creates a new authentication service
-func NewAuthService(configPath string, userStorage storage.UserStorage) (*AuthService, error) {
-	config, err := loadConfig(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %v", err)
-	}
-
-	return &AuthService{
-		config:       config,
+func NewAuthService(config *models.Config, userStorage storage.UserStorage) *AuthService {
+	as := &AuthService{
 		userStorage:  userStorage,
 		activeTokens: make(map[string]*TokenInfo),
-	}, nil
-}
-
-// loadConfig loads configuration from YAML file
-func loadConfig(configPath string) (*models.Config, error) {
-	data, err := ioutil.ReadFile(configPath)
-	if err != nil {
-		return nil, err
-	}
-
-	var config models.Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, err
 	}
+	as.settings.Store(&authSettings{
+		secret:      []byte(config.JWTSecret),
+		tokenExpiry: time.Duration(config.TokenExpiryHours) * time.Hour,
+	})
+	return as
+}
 
-	// Set default values if not specified
-	if config.TokenExpiryHours == 0 {
-		config.TokenExpiryHours = 24
+// Reload applies a new configuration's JWT secret and token expiry. If the
+// secret has changed, share tokens signed with the old one are still
+// accepted for the configured grace period. Tokens already issued keep the
+// expiry they were given.
+func (as *AuthService) Reload(config *models.Config) {
+	current := as.settings.Load()
+	next := &authSettings{
+		secret:         []byte(config.JWTSecret),
+		tokenExpiry:    time.Duration(config.TokenExpiryHours) * time.Hour,
+		previousSecret: current.previousSecret,
+		previousUntil:  current.previousUntil,
 	}
-	if config.JWTSecret == "" {
-		config.JWTSecret = "default-secret-change-this"
+	if !hmac.Equal(next.secret, current.secret) {
+		next.previousSecret = current.secret
+		next.previousUntil = time.Now().Add(config.SecretGrace())
 	}
-
-	return &config, nil
+	as.settings.Store(next)
 }
 
-// ValidateCredentials checks if username and password are valid
-func (as *AuthService) ValidateCredentials(username, password string) (*models.User, bool) {
-	user, err := as.userStorage.ValidateCredentials(username, password)
-	if err != nil {
-		return nil, false
-	}
-	return user, true
+// ValidateCredentials checks if username and password are valid. It returns
+// storage.ErrInvalidCredentials if they are not, and other errors if they
+// could not be checked.
+func (as *AuthService) ValidateCredentials(ctx context.Context, username, password string) (*models.User, error) {
+	return as.userStorage.ValidateCredentials(ctx, username, password)
 }
 
 // GenerateToken creates a new authentication token
@@ -82,23 +88,24 @@ func (as *AuthService) GenerateToken(user *models.User) (string, error) {
 	if _, err := rand.Read(tokenBytes); err != nil {
 		return "", fmt.Errorf("failed to generate token: %v", err)
 	}
-	
+
 	token := hex.EncodeToString(tokenBytes)
-	
+
 	// Store token info
 	as.mutex.Lock()
 	defer as.mutex.Unlock()
-	
+
 	now := time.Now()
-	expiresAt := now.Add(time.Duration(as.config.TokenExpiryHours) * time.Hour)
-	
+	expiresAt := now.Add(as.settings.Load().tokenExpiry)
+
 	as.activeTokens[token] = &TokenInfo{
 		Username:  user.Username,
 		UserID:    user.ID,
+		IsAdmin:   user.IsAdmin,
 		CreatedAt: now,
 		ExpiresAt: expiresAt,
 	}
-	
+
 	return token, nil
 }
 
@@ -106,19 +113,19 @@ func (as *AuthService) GenerateToken(user *models.User) (string, error) {
 func (as *AuthService) ValidateToken(token string) (*TokenInfo, bool) {
 	as.mutex.RLock()
 	defer as.mutex.RUnlock()
-	
+
 	tokenInfo, exists := as.activeTokens[token]
 	if !exists {
 		return nil, false
 	}
-	
+
 	// Check if token is expired
 	if time.Now().After(tokenInfo.ExpiresAt) {
 		// Remove expired token
 		go as.removeToken(token)
 		return nil, false
 	}
-	
+
 	return tokenInfo, true
 }
 
@@ -126,7 +133,7 @@ func (as *AuthService) ValidateToken(token string) (*TokenInfo, bool) {
 func (as *AuthService) InvalidateToken(token string) bool {
 	as.mutex.Lock()
 	defer as.mutex.Unlock()
-	
+
 	_, exists := as.activeTokens[token]
 	if exists {
 		delete(as.activeTokens, token)
@@ -135,6 +142,17 @@ func (as *AuthService) InvalidateToken(token string) bool {
 	return false
 }
 
+// InvalidateAll removes every active token, logging everyone out, and
+// returns how many were removed
+func (as *AuthService) InvalidateAll() int {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	count := len(as.activeTokens)
+	as.activeTokens = make(map[string]*TokenInfo)
+	return count
+}
+
 // removeToken removes a token (used for cleanup)
 func (as *AuthService) removeToken(token string) {
 	as.mutex.Lock()
@@ -146,7 +164,7 @@ func (as *AuthService) removeToken(token string) {
 func (as *AuthService) CleanupExpiredTokens() {
 	as.mutex.Lock()
 	defer as.mutex.Unlock()
-	
+
 	now := time.Now()
 	for token, tokenInfo := range as.activeTokens {
 		if now.After(tokenInfo.ExpiresAt) {
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned when verifying share tokens
+var (
+	ErrInvalidShareToken = errors.New("invalid share token")
+	ErrExpiredShareToken = errors.New("share token has expired")
+)
+
+// SignShareToken creates a token granting read access through the given
+// share link until expiresAt. The token is signed with the configured
+// JWT secret so it cannot be forged or have its expiry extended.
+func (as *AuthService) SignShareToken(linkID string, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%s:%d", linkID, expiresAt.Unix())
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + signShareTokenPayload(as.settings.Load().secret, encoded)
+}
+
+// VerifyShareToken checks a share token's signature and expiry and returns
+// the share link ID it was issued for. Revocation is checked by the caller.
+// During the grace period after the secret is rotated, tokens signed with
+// the previous secret are accepted too.
+func (as *AuthService) VerifyShareToken(token string) (string, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return "", ErrInvalidShareToken
+	}
+
+	settings := as.settings.Load()
+	valid := hmac.Equal([]byte(signature), []byte(signShareTokenPayload(settings.secret, encoded)))
+	if !valid && settings.previousSecret != nil && time.Now().Before(settings.previousUntil) {
+		valid = hmac.Equal([]byte(signature), []byte(signShareTokenPayload(settings.previousSecret, encoded)))
+	}
+	if !valid {
+		return "", ErrInvalidShareToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidShareToken
+	}
+
+	linkID, expiry, found := strings.Cut(string(payload), ":")
+	if !found {
+		return "", ErrInvalidShareToken
+	}
+
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", ErrInvalidShareToken
+	}
+
+	if time.Now().After(time.Unix(expiresAt, 0)) {
+		return "", ErrExpiredShareToken
+	}
+
+	return linkID, nil
+}
+
+// signShareTokenPayload returns the base64url HMAC-SHA256 of an encoded
+// payload under secret
+func signShareTokenPayload(secret []byte, encoded string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
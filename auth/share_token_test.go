@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"recipe-api/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig returns a configuration with the given JWT secret and share
+// token grace window
+func testConfig(secret string, graceHours int) *models.Config {
+	return &models.Config{
+		JWTSecret:        secret,
+		TokenExpiryHours: 24,
+		SecretGraceHours: &graceHours,
+	}
+}
+
+func TestVerifyShareToken(t *testing.T) {
+	inAnHour := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name string
+		// token is issued by an AuthService started with secret "old"
+		// and a grace window of one hour, and verified after rotate
+		token   func(as *AuthService) string
+		rotate  func(as *AuthService)
+		wantID  string
+		wantErr error
+	}{
+		{
+			name:   "valid token",
+			token:  func(as *AuthService) string { return as.SignShareToken("link-1", inAnHour) },
+			wantID: "link-1",
+		},
+		{
+			name:    "expired token",
+			token:   func(as *AuthService) string { return as.SignShareToken("link-1", time.Now().Add(-time.Second)) },
+			wantErr: ErrExpiredShareToken,
+		},
+		{
+			name: "link ID changed",
+			token: func(as *AuthService) string {
+				_, signature, _ := strings.Cut(as.SignShareToken("link-1", inAnHour), ".")
+				payload := base64.RawURLEncoding.EncodeToString([]byte("link-2:" + "9999999999"))
+				return payload + "." + signature
+			},
+			wantErr: ErrInvalidShareToken,
+		},
+		{
+			name: "expiry extended",
+			token: func(as *AuthService) string {
+				original := as.SignShareToken("link-1", time.Now().Add(-time.Hour))
+				_, signature, _ := strings.Cut(original, ".")
+				payload := base64.RawURLEncoding.EncodeToString([]byte("link-1:9999999999"))
+				return payload + "." + signature
+			},
+			wantErr: ErrInvalidShareToken,
+		},
+		{
+			name:    "no signature",
+			token:   func(*AuthService) string { return "bGluay0xOjk5OTk5OTk5OTk" },
+			wantErr: ErrInvalidShareToken,
+		},
+		{
+			name: "signed payload without an expiry",
+			token: func(as *AuthService) string {
+				payload := base64.RawURLEncoding.EncodeToString([]byte("link-1"))
+				return payload + "." + signShareTokenPayload([]byte("old"), payload)
+			},
+			wantErr: ErrInvalidShareToken,
+		},
+		{
+			name:   "previous secret within the grace window",
+			token:  func(as *AuthService) string { return as.SignShareToken("link-1", inAnHour) },
+			rotate: func(as *AuthService) { as.Reload(testConfig("new", 1)) },
+			wantID: "link-1",
+		},
+		{
+			name:    "previous secret without a grace window",
+			token:   func(as *AuthService) string { return as.SignShareToken("link-1", inAnHour) },
+			rotate:  func(as *AuthService) { as.Reload(testConfig("new", 0)) },
+			wantErr: ErrInvalidShareToken,
+		},
+		{
+			name:  "previous secret after the grace window",
+			token: func(as *AuthService) string { return as.SignShareToken("link-1", inAnHour) },
+			rotate: func(as *AuthService) {
+				as.Reload(testConfig("new", 1))
+				settings := *as.settings.Load()
+				settings.previousUntil = time.Now().Add(-time.Second)
+				as.settings.Store(&settings)
+			},
+			wantErr: ErrInvalidShareToken,
+		},
+		{
+			name:   "reload without a new secret keeps the grace window",
+			token:  func(as *AuthService) string { return as.SignShareToken("link-1", inAnHour) },
+			rotate: func(as *AuthService) { as.Reload(testConfig("new", 1)); as.Reload(testConfig("new", 0)) },
+			wantID: "link-1",
+		},
+		{
+			name:    "secret rotated twice",
+			token:   func(as *AuthService) string { return as.SignShareToken("link-1", inAnHour) },
+			rotate:  func(as *AuthService) { as.Reload(testConfig("new", 1)); as.Reload(testConfig("newer", 1)) },
+			wantErr: ErrInvalidShareToken,
+		},
+		{
+			name: "token signed with the new secret",
+			token: func(as *AuthService) string {
+				as.Reload(testConfig("new", 1))
+				return as.SignShareToken("link-1", inAnHour)
+			},
+			wantID: "link-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as := NewAuthService(testConfig("old", 1), nil)
+			token := tt.token(as)
+			if tt.rotate != nil {
+				tt.rotate(as)
+			}
+
+			id, err := as.VerifyShareToken(token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyShareToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if id != tt.wantID {
+				t.Errorf("VerifyShareToken() = %q, want %q", id, tt.wantID)
+			}
+		})
+	}
+}
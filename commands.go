@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"recipe-api/config"
+	"recipe-api/database"
+	"recipe-api/models"
+	"recipe-api/storage"
+
+	"gopkg.in/yaml.v2"
+)
+
+// runCommand runs a CLI subcommand instead of starting the server.
+// configPath is the configuration file given with --config.
+func runCommand(configPath, name string, args []string) error {
+	switch name {
+	case "backup":
+		return backupCommand(configPath, args)
+	case "restore":
+		return restoreCommand(configPath, args)
+	case "config":
+		return configCommand(configPath, args)
+	default:
+		return fmt.Errorf("unknown command %q (available: backup, restore, config)", name)
+	}
+}
+
+// backupCommand writes a backup archive of the database to a file or stdout
+func backupCommand(configPath string, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := flags.String("o", "", "write the archive to this file instead of stdout")
+	includeHashes := flags.Bool("include-password-hashes", false, "include user password hashes in the archive")
+	flags.Parse(args)
+
+	db, err := openCommandDB(configPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	version, err := database.MigrationVersion(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", *output, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	opts := models.BackupOptions{IncludePasswordHashes: *includeHashes}
+	if err := storage.NewPostgresBackupStorage(db).Dump(context.Background(), w, version, opts); err != nil {
+		return err
+	}
+
+	slog.Info("Backup written", "schema_version", version)
+	return nil
+}
+
+// restoreCommand migrates the database and loads a backup archive into it.
+// Login sessions live in the server's memory, so a running server must be
+// restarted to end them.
+func restoreCommand(configPath string, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	input := flags.String("i", "", "read the archive from this file instead of stdin")
+	flags.Parse(args)
+
+	db, err := openCommandDB(configPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := database.RunMigrations(db); err != nil {
+		return err
+	}
+
+	version, err := database.MigrationVersion(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", *input, err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	summary, err := storage.NewPostgresBackupStorage(db).Restore(context.Background(), r, version)
+	if err != nil {
+		return err
+	}
+
+	for table, count := range summary.Rows {
+		slog.Info("Restored rows", "table", table, "rows", count)
+	}
+	slog.Warn("Restart any running server to end login sessions from before the restore")
+	return nil
+}
+
+// configCommand handles "config print", which writes the effective
+// configuration as YAML with secrets redacted, then reports any validation
+// errors
+func configCommand(configPath string, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return fmt.Errorf("usage: config print")
+	}
+
+	cfg, err := config.Read(configPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(config.Redact(*cfg))
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %v", err)
+	}
+	os.Stdout.Write(data)
+
+	if err := config.Validate(cfg); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+	return nil
+}
+
+// openCommandDB loads the configuration and connects to the database
+func openCommandDB(configPath string) (*sql.DB, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %v", err)
+	}
+
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %v", err)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,393 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"recipe-api/models"
+	"recipe-api/tracing"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultPath is the configuration file read when --config is not given
+const DefaultPath = "config.yaml"
+
+// EnvPrefix starts the name of every environment variable that overrides a
+// configuration field. The rest of the name is the field's YAML path in
+// upper case joined by underscores, e.g. RECIPE_DATABASE_HOST.
+const EnvPrefix = "RECIPE_"
+
+// Redacted replaces the value of secret fields when the configuration is printed
+const Redacted = "REDACTED"
+
+// devJWTSecret is the JWT secret used in dev mode when none is configured
+const devJWTSecret = "dev-secret-do-not-use-in-production"
+
+// defaultOTLPEndpoint is where the otlp trace exporter sends spans when
+// tracing.endpoint is not set: a collector on this host
+const defaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+// minJWTSecretLength is the shortest JWT secret accepted outside dev mode
+const minJWTSecretLength = 32
+
+// placeholderSecrets are sample secrets from the documentation and earlier
+// defaults, which are never accepted outside dev mode
+var placeholderSecrets = map[string]bool{
+	"default-secret-change-this":                          true,
+	"your-super-secret-jwt-key-change-this-in-production": true,
+	devJWTSecret: true,
+}
+
+// validSSLModes lists the sslmode values PostgreSQL accepts
+var validSSLModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// Load reads the configuration with Read and validates it
+func Load(path string) (*models.Config, error) {
+	config, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Validate(config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	return config, nil
+}
+
+// Read reads the configuration file at path and applies RECIPE_* environment
+// overrides and defaults, without validating the result. An empty path skips
+// the file, so the configuration comes from the environment alone.
+func Read(path string) (*models.Config, error) {
+	var config models.Config
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %v", err)
+		}
+		if err := yaml.UnmarshalStrict(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(&config).Elem(), EnvPrefix); err != nil {
+		return nil, err
+	}
+	applyDefaults(&config)
+
+	return &config, nil
+}
+
+// ParseLogLevel returns the slog level named by a log_level setting
+func ParseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+// applyEnv sets each field of the struct v from the environment variable
+// named after its YAML key, descending into nested structs
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := prefix + strings.ToUpper(yamlKey(field))
+		value := v.Field(i)
+
+		if value.Kind() == reflect.Struct {
+			if err := applyEnv(value, name+"_"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		// Optional settings are set through a new value
+		if value.Kind() == reflect.Pointer {
+			value.Set(reflect.New(value.Type().Elem()))
+			value = value.Elem()
+		}
+
+		switch value.Kind() {
+		case reflect.String:
+			value.SetString(raw)
+		case reflect.Int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("%s must be an integer, got %q", name, raw)
+			}
+			value.SetInt(int64(n))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s must be true or false, got %q", name, raw)
+			}
+			value.SetBool(b)
+		default:
+			return fmt.Errorf("%s cannot be set from the environment", name)
+		}
+	}
+	return nil
+}
+
+// yamlKey returns the YAML key of a struct field
+func yamlKey(field reflect.StructField) string {
+	key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if key == "" {
+		return strings.ToLower(field.Name)
+	}
+	return key
+}
+
+// intPtr returns a pointer to n, for defaults of optional settings
+func intPtr(n int) *int {
+	return &n
+}
+
+// applyDefaults fills in fields that were left unset. Optional settings
+// whose 0 is meaningful are only defaulted when nil.
+func applyDefaults(config *models.Config) {
+	if config.ListenAddr == "" {
+		config.ListenAddr = ":8080"
+	}
+	if config.LogLevel == "" {
+		config.LogLevel = "info"
+	}
+	if config.Database.Host == "" {
+		config.Database.Host = "localhost"
+	}
+	if config.Database.Port == 0 {
+		config.Database.Port = 5432
+	}
+	if config.Database.QueryTimeoutSeconds == nil {
+		config.Database.QueryTimeoutSeconds = intPtr(10)
+	}
+	if config.Database.MaxOpenConns == 0 {
+		config.Database.MaxOpenConns = 25
+	}
+	if config.Database.MaxIdleConns == 0 {
+		config.Database.MaxIdleConns = config.Database.MaxOpenConns
+	}
+	if config.TokenExpiryHours == 0 {
+		config.TokenExpiryHours = 24
+	}
+	if config.JWTSecret == "" && config.DevMode {
+		config.JWTSecret = devJWTSecret
+	}
+	if config.SecretGraceHours == nil {
+		config.SecretGraceHours = intPtr(24)
+	}
+	if config.IdempotencyKeyTTLHours == 0 {
+		config.IdempotencyKeyTTLHours = 24
+	}
+	if config.RequestTimeoutSeconds == nil {
+		config.RequestTimeoutSeconds = intPtr(30)
+	}
+	if config.ReadTimeoutSeconds == 0 {
+		config.ReadTimeoutSeconds = 30
+	}
+	if config.WriteTimeoutSeconds == 0 {
+		config.WriteTimeoutSeconds = 60
+	}
+	if config.IdleTimeoutSeconds == 0 {
+		config.IdleTimeoutSeconds = 120
+	}
+	if config.ShutdownTimeoutSeconds == 0 {
+		config.ShutdownTimeoutSeconds = 30
+	}
+	if config.Tracing.Exporter == "" {
+		config.Tracing.Exporter = tracing.ExporterNone
+	}
+	if config.Tracing.Endpoint == "" && config.Tracing.Exporter == tracing.ExporterOTLP {
+		config.Tracing.Endpoint = defaultOTLPEndpoint
+	}
+	if config.Tracing.ServiceName == "" {
+		config.Tracing.ServiceName = "recipe-api"
+	}
+}
+
+// Validate checks a configuration, reporting every invalid field. Outside
+// dev mode the JWT secret must be set, at least 32 bytes long and not one of
+// the sample secrets.
+func Validate(config *models.Config) error {
+	var problems models.FieldErrors
+	invalid := func(field, format string, args ...interface{}) {
+		problems = append(problems, models.FieldError{
+			Field:   field,
+			Message: field + " " + fmt.Sprintf(format, args...),
+		})
+	}
+
+	if _, _, err := net.SplitHostPort(config.ListenAddr); err != nil {
+		invalid("listen_addr", "must be host:port: %v", err)
+	}
+	if _, err := ParseLogLevel(config.LogLevel); err != nil {
+		invalid("log_level", "must be one of debug, info, warn, error")
+	}
+
+	db := config.Database
+	if db.Port < 1 || db.Port > 65535 {
+		invalid("database.port", "must be between 1 and 65535")
+	}
+	if db.User == "" {
+		invalid("database.user", "is required")
+	}
+	if db.DBName == "" {
+		invalid("database.dbname", "is required")
+	}
+	if db.SSLMode != "" && !validSSLModes[db.SSLMode] {
+		invalid("database.sslmode", "must be one of disable, allow, prefer, require, verify-ca, verify-full")
+	}
+	if db.QueryTimeoutSeconds != nil && *db.QueryTimeoutSeconds < 0 {
+		invalid("database.query_timeout_seconds", "must not be negative")
+	}
+	if db.MaxOpenConns < 1 {
+		invalid("database.max_open_conns", "must be at least 1")
+	}
+	if db.MaxIdleConns < 0 || db.MaxIdleConns > db.MaxOpenConns {
+		invalid("database.max_idle_conns", "must be between 0 and max_open_conns")
+	}
+
+	if !config.DevMode {
+		switch {
+		case config.JWTSecret == "":
+			invalid("jwt_secret", "is required outside dev mode")
+		case placeholderSecrets[config.JWTSecret]:
+			invalid("jwt_secret", "is a sample secret; generate a random one")
+		case len(config.JWTSecret) < minJWTSecretLength:
+			invalid("jwt_secret", "must be at least %d bytes outside dev mode", minJWTSecretLength)
+		}
+	}
+
+	if config.TokenExpiryHours < 1 {
+		invalid("token_expiry_hours", "must be at least 1")
+	}
+	if config.SecretGraceHours != nil && *config.SecretGraceHours < 0 {
+		invalid("secret_grace_hours", "must not be negative")
+	}
+	if config.IdempotencyKeyTTLHours < 1 {
+		invalid("idempotency_key_ttl_hours", "must be at least 1")
+	}
+	if config.RequestTimeoutSeconds != nil && *config.RequestTimeoutSeconds < 0 {
+		invalid("request_timeout_seconds", "must not be negative")
+	}
+	if config.ReadTimeoutSeconds < 1 {
+		invalid("read_timeout_seconds", "must be at least 1")
+	}
+	if time.Duration(config.WriteTimeoutSeconds)*time.Second <= config.RequestTimeout() {
+		invalid("write_timeout_seconds", "must be greater than request_timeout_seconds")
+	}
+	if config.IdleTimeoutSeconds < 1 {
+		invalid("idle_timeout_seconds", "must be at least 1")
+	}
+	if config.ShutdownTimeoutSeconds < 1 {
+		invalid("shutdown_timeout_seconds", "must be at least 1")
+	}
+
+	switch config.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout:
+	case tracing.ExporterOTLP:
+		if u, err := url.Parse(config.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("tracing.endpoint", "must be an http or https URL")
+		}
+	default:
+		invalid("tracing.exporter", "must be one of none, otlp, stdout")
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// Redact returns a copy of config with every field tagged secret:"true"
+// replaced by Redacted, or left empty if it was not set
+func Redact(config models.Config) models.Config {
+	redactValue(reflect.ValueOf(&config).Elem())
+	return config
+}
+
+// redactValue redacts the secret fields of the struct v in place
+func redactValue(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		value := v.Field(i)
+		switch {
+		case value.Kind() == reflect.Struct:
+			redactValue(value)
+		case t.Field(i).Tag.Get("secret") == "true" && value.String() != "":
+			value.SetString(Redacted)
+		}
+	}
+}
+
+// Change describes a setting that differs between two configurations.
+// Secret values are redacted.
+type Change struct {
+	Key string
+	Old string
+	New string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Key, c.Old, c.New)
+}
+
+// Diff lists the settings that differ between old and new, in field order
+func Diff(old, new models.Config) []Change {
+	return diffValues(reflect.ValueOf(old), reflect.ValueOf(new),
+		reflect.ValueOf(Redact(old)), reflect.ValueOf(Redact(new)), "")
+}
+
+// settingValue returns the value of a setting, following the pointer of an
+// optional one; unset optional settings are "unset"
+func settingValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "unset"
+		}
+		v = v.Elem()
+	}
+	return v.Interface()
+}
+
+// diffValues compares the structs a and b field by field, reporting the
+// matching fields of their redacted copies so that secrets are not shown
+func diffValues(a, b, redactedA, redactedB reflect.Value, prefix string) []Change {
+	var changes []Change
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := prefix + yamlKey(t.Field(i))
+		if a.Field(i).Kind() == reflect.Struct {
+			changes = append(changes, diffValues(a.Field(i), b.Field(i), redactedA.Field(i), redactedB.Field(i), key+".")...)
+			continue
+		}
+		if settingValue(a.Field(i)) != settingValue(b.Field(i)) {
+			changes = append(changes, Change{
+				Key: key,
+				Old: fmt.Sprint(settingValue(redactedA.Field(i))),
+				New: fmt.Sprint(settingValue(redactedB.Field(i))),
+			})
+		}
+	}
+	return changes
+}
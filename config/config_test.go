@@ -0,0 +1,327 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"recipe-api/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns a configuration that passes Validate, with defaults
+// applied
+func validConfig() models.Config {
+	config := models.Config{
+		JWTSecret: strings.Repeat("s", minJWTSecretLength),
+		Database:  models.DatabaseConfig{User: "recipe", DBName: "recipes"},
+	}
+	applyDefaults(&config)
+	return config
+}
+
+// invalidFields returns the fields Validate reports for config
+func invalidFields(t *testing.T, config models.Config) []string {
+	t.Helper()
+	err := Validate(&config)
+	if err == nil {
+		return nil
+	}
+	var problems models.FieldErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("Validate() error = %v, want models.FieldErrors", err)
+	}
+	var fields []string
+	for _, problem := range problems {
+		fields = append(fields, problem.Field)
+	}
+	return fields
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*models.Config)
+		want   []string
+	}{
+		{
+			name:   "defaults are valid",
+			change: func(*models.Config) {},
+		},
+		{
+			name: "zero timeouts and grace window are valid",
+			change: func(c *models.Config) {
+				c.Database.QueryTimeoutSeconds = intPtr(0)
+				c.RequestTimeoutSeconds = intPtr(0)
+				c.SecretGraceHours = intPtr(0)
+			},
+		},
+		{
+			name:   "unset optional settings are valid",
+			change: func(c *models.Config) { c.SecretGraceHours, c.RequestTimeoutSeconds = nil, nil },
+		},
+		{
+			name: "negative optional settings",
+			change: func(c *models.Config) {
+				c.Database.QueryTimeoutSeconds = intPtr(-1)
+				c.SecretGraceHours = intPtr(-1)
+				c.RequestTimeoutSeconds = intPtr(-1)
+			},
+			want: []string{"database.query_timeout_seconds", "secret_grace_hours", "request_timeout_seconds"},
+		},
+		{
+			name: "dev mode needs no JWT secret",
+			change: func(c *models.Config) {
+				c.DevMode = true
+				c.JWTSecret = ""
+			},
+		},
+		{
+			name:   "missing JWT secret",
+			change: func(c *models.Config) { c.JWTSecret = "" },
+			want:   []string{"jwt_secret"},
+		},
+		{
+			name:   "sample JWT secret",
+			change: func(c *models.Config) { c.JWTSecret = "your-super-secret-jwt-key-change-this-in-production" },
+			want:   []string{"jwt_secret"},
+		},
+		{
+			name:   "short JWT secret",
+			change: func(c *models.Config) { c.JWTSecret = "short" },
+			want:   []string{"jwt_secret"},
+		},
+		{
+			name:   "write timeout must exceed the request timeout",
+			change: func(c *models.Config) { c.WriteTimeoutSeconds = 30 },
+			want:   []string{"write_timeout_seconds"},
+		},
+		{
+			name: "database settings",
+			change: func(c *models.Config) {
+				c.Database.Port = 70000
+				c.Database.User = ""
+				c.Database.DBName = ""
+				c.Database.SSLMode = "sometimes"
+				c.Database.MaxIdleConns = c.Database.MaxOpenConns + 1
+			},
+			want: []string{"database.port", "database.user", "database.dbname", "database.sslmode", "database.max_idle_conns"},
+		},
+		{
+			name: "listen address and log level",
+			change: func(c *models.Config) {
+				c.ListenAddr = "8080"
+				c.LogLevel = "verbose"
+			},
+			want: []string{"listen_addr", "log_level"},
+		},
+		{
+			name:   "unknown tracing exporter",
+			change: func(c *models.Config) { c.Tracing.Exporter = "jaeger" },
+			want:   []string{"tracing.exporter"},
+		},
+		{
+			name: "otlp exporter needs an http URL",
+			change: func(c *models.Config) {
+				c.Tracing.Exporter = "otlp"
+				c.Tracing.Endpoint = "localhost:4318"
+			},
+			want: []string{"tracing.endpoint"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig()
+			tt.change(&config)
+			if got := invalidFields(t, config); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() invalid fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadEnvOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		check   func(*testing.T, *models.Config)
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, c *models.Config) {
+				if c.ListenAddr != ":8080" || c.Database.Port != 5432 || c.Database.MaxIdleConns != 25 {
+					t.Errorf("Read() = %+v, want the defaults", c)
+				}
+				if c.RequestTimeout() != 30*time.Second || c.SecretGrace() != 24*time.Hour || *c.Database.QueryTimeoutSeconds != 10 {
+					t.Errorf("Read() optional settings = %v, %v, %d, want the defaults",
+						c.RequestTimeout(), c.SecretGrace(), *c.Database.QueryTimeoutSeconds)
+				}
+			},
+		},
+		{
+			name: "environment overrides the file",
+			file: "listen_addr: \":9000\"\ndatabase:\n  host: db\n  port: 6543\n",
+			env: map[string]string{
+				"RECIPE_DATABASE_HOST": "override",
+				"RECIPE_DEV_MODE":      "true",
+				"RECIPE_JWT_SECRET":    "from-env",
+			},
+			check: func(t *testing.T, c *models.Config) {
+				if c.ListenAddr != ":9000" || c.Database.Host != "override" || c.Database.Port != 6543 {
+					t.Errorf("Read() = %+v, want the file with the host overridden", c)
+				}
+				if !c.DevMode || c.JWTSecret != "from-env" {
+					t.Errorf("Read() dev_mode = %v, jwt_secret = %q, want the environment values", c.DevMode, c.JWTSecret)
+				}
+			},
+		},
+		{
+			name: "explicit zero in the file is kept",
+			file: "secret_grace_hours: 0\nrequest_timeout_seconds: 0\n",
+			check: func(t *testing.T, c *models.Config) {
+				if c.SecretGrace() != 0 || c.RequestTimeout() != 0 {
+					t.Errorf("Read() grace = %v, request timeout = %v, want 0", c.SecretGrace(), c.RequestTimeout())
+				}
+			},
+		},
+		{
+			name: "explicit zero in the environment is kept",
+			env:  map[string]string{"RECIPE_DATABASE_QUERY_TIMEOUT_SECONDS": "0"},
+			check: func(t *testing.T, c *models.Config) {
+				if c.Database.QueryTimeoutSeconds == nil || *c.Database.QueryTimeoutSeconds != 0 {
+					t.Errorf("Read() query_timeout_seconds = %v, want 0", c.Database.QueryTimeoutSeconds)
+				}
+			},
+		},
+		{
+			name:    "invalid integer",
+			env:     map[string]string{"RECIPE_DATABASE_PORT": "five"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid boolean",
+			env:     map[string]string{"RECIPE_DEV_MODE": "maybe"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown key in the file",
+			file:    "listen_address: \":9000\"\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			path := ""
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			config, err := Read(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Read() = %+v, want an error", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			tt.check(t, config)
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	config := validConfig()
+	config.Database.Password = "hunter2"
+
+	redacted := Redact(config)
+	if redacted.JWTSecret != Redacted || redacted.Database.Password != Redacted {
+		t.Errorf("Redact() secrets = %q, %q, want %q", redacted.JWTSecret, redacted.Database.Password, Redacted)
+	}
+	if redacted.Database.User != config.Database.User {
+		t.Errorf("Redact() database.user = %q, want %q", redacted.Database.User, config.Database.User)
+	}
+
+	config.Database.Password = ""
+	if redacted := Redact(config); redacted.Database.Password != "" {
+		t.Errorf("Redact() unset password = %q, want it left empty", redacted.Database.Password)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*models.Config)
+		want   []string
+	}{
+		{
+			name:   "no changes",
+			change: func(*models.Config) {},
+		},
+		{
+			name: "changes in field order",
+			change: func(c *models.Config) {
+				c.Tracing.Exporter = "stdout"
+				c.LogLevel = "debug"
+				c.Database.MaxOpenConns = 50
+			},
+			want: []string{
+				"log_level: info -> debug",
+				"database.max_open_conns: 25 -> 50",
+				"tracing.exporter: none -> stdout",
+			},
+		},
+		{
+			name: "optional settings compare by value",
+			change: func(c *models.Config) {
+				c.RequestTimeoutSeconds = intPtr(30)
+				c.SecretGraceHours = intPtr(0)
+				c.Database.QueryTimeoutSeconds = nil
+			},
+			want: []string{
+				"database.query_timeout_seconds: 10 -> unset",
+				"secret_grace_hours: 24 -> 0",
+			},
+		},
+		{
+			name: "secrets are redacted",
+			change: func(c *models.Config) {
+				c.JWTSecret = strings.Repeat("n", minJWTSecretLength)
+				c.Database.Password = "hunter2"
+			},
+			want: []string{
+				"database.password:  -> REDACTED",
+				"jwt_secret: REDACTED -> REDACTED",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, updated := validConfig(), validConfig()
+			tt.change(&updated)
+
+			var got []string
+			for _, change := range Diff(old, updated) {
+				got = append(got, change.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
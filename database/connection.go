@@ -4,45 +4,43 @@ import (
 	"database/sql"
 	"fmt"
 	"recipe-api/models"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
-// DB holds the database connection
-var DB *sql.DB
+// DefaultQueryTimeout is used when the configuration does not set a query timeout
+const DefaultQueryTimeout = 10 * time.Second
 
-// InitDB initializes the database connection
-func InitDB(config models.DatabaseConfig) error {
+// Open opens and pings a connection pool for the configured database. The
+// caller owns the returned handle and must close it.
+func Open(config models.DatabaseConfig) (*sql.DB, error) {
 	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		config.Host, config.Port, config.User, config.Password, config.DBName, config.SSLMode)
 
-	var err error
-	DB, err = sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", connStr)
 	if err != nil {
-		return fmt.Errorf("failed to open database connection: %v", err)
+		return nil, fmt.Errorf("failed to open database connection: %v", err)
 	}
 
 	// Test the connection
-	if err = DB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %v", err)
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %v", err)
 	}
 
 	// Set connection pool settings
-	DB.SetMaxOpenConns(25)
-	DB.SetMaxIdleConns(25)
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
 
-	return nil
+	return db, nil
 }
 
-// CloseDB closes the database connection
-func CloseDB() error {
-	if DB != nil {
-		return DB.Close()
+// QueryTimeout returns how long a single storage call may take under the
+// given configuration; 0 means no bound
+func QueryTimeout(config models.DatabaseConfig) time.Duration {
+	if config.QueryTimeoutSeconds == nil {
+		return DefaultQueryTimeout
 	}
-	return nil
-}
-
-// GetDB returns the database connection
-func GetDB() *sql.DB {
-	return DB
+	return time.Duration(*config.QueryTimeoutSeconds) * time.Second
 }
@@ -1,27 +1,32 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
-// RunMigrations runs database migrations
-func RunMigrations(databaseURL string) error {
-	if DB == nil {
-		return fmt.Errorf("database connection not initialized")
-	}
+// migrationsDir holds the migration files, named <version>_<name>.up.sql and
+// <version>_<name>.down.sql
+const migrationsDir = "migrations"
 
-	driver, err := postgres.WithInstance(DB, &postgres.Config{})
+// RunMigrations runs database migrations on db
+func RunMigrations(db *sql.DB) error {
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
 	if err != nil {
 		return fmt.Errorf("failed to create migration driver: %v", err)
 	}
 
 	m, err := migrate.NewWithDatabaseInstance(
-		"file://migrations",
+		"file://"+migrationsDir,
 		"postgres", driver)
 	if err != nil {
 		return fmt.Errorf("failed to create migration instance: %v", err)
@@ -33,10 +38,57 @@ func RunMigrations(databaseURL string) error {
 	}
 
 	if err == migrate.ErrNoChange {
-		log.Println("No new migrations to run")
+		slog.Info("No new migrations to run")
 	} else {
-		log.Println("Migrations completed successfully")
+		slog.Info("Migrations completed successfully")
 	}
 
 	return nil
 }
+
+// MigrationVersion returns the schema version the database is migrated to,
+// read from the table golang-migrate records it in. The query is cancelled
+// with ctx.
+func MigrationVersion(ctx context.Context, db *sql.DB) (uint, error) {
+	var version uint
+	var dirty bool
+	err := db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get migration version: %v", err)
+	}
+	if dirty {
+		return 0, fmt.Errorf("database is in a dirty migration state at version %d", version)
+	}
+
+	return version, nil
+}
+
+// LatestMigrationVersion returns the highest version among the migration
+// files, which is the version RunMigrations brings the database to
+func LatestMigrationVersion() (uint, error) {
+	entries, err := os.ReadDir(migrationsDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	var latest uint
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".up.sql") {
+			continue
+		}
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s has no version number", name)
+		}
+		if uint(version) > latest {
+			latest = uint(version)
+		}
+	}
+
+	return latest, nil
+}
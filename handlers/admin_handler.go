@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"recipe-api/auth"
+	"recipe-api/models"
+	"recipe-api/storage"
+	"strconv"
+	"time"
+)
+
+// maxRestoreBodyBytes limits the size of backup archives accepted for restore
+const maxRestoreBodyBytes = 512 << 20
+
+// AdminHandler handles administrator-only HTTP requests
+type AdminHandler struct {
+	backupStorage storage.BackupStorage
+	authService   *auth.AuthService
+	schemaVersion func(context.Context) (uint, error)
+}
+
+// NewAdminHandler creates a new admin handler. schemaVersion reports the
+// migration version the database is currently at.
+func NewAdminHandler(backupStorage storage.BackupStorage, authService *auth.AuthService, schemaVersion func(context.Context) (uint, error)) *AdminHandler {
+	return &AdminHandler{
+		backupStorage: backupStorage,
+		authService:   authService,
+		schemaVersion: schemaVersion,
+	}
+}
+
+// RegisterRoutes registers the admin routes on api. protect wraps every
+// route and must require an administrator.
+func (adh *AdminHandler) RegisterRoutes(api *API, protect func(http.HandlerFunc) http.HandlerFunc) {
+	api.HandleStreaming("/admin/backup", Routes{"GET": protect(adh.HandleBackup)})
+	api.HandleStreaming("/admin/restore", Routes{"POST": protect(adh.HandleRestore)})
+}
+
+// HandleBackup handles requests to /api/admin/backup (GET), streaming a
+// backup archive. Password hashes are left out unless
+// ?include_password_hashes=true is given.
+func (adh *AdminHandler) HandleBackup(w http.ResponseWriter, r *http.Request) {
+	version, err := adh.schemaVersion(r.Context())
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get schema version")
+		return
+	}
+
+	includeHashes, _ := strconv.ParseBool(r.URL.Query().Get("include_password_hashes"))
+	filename := fmt.Sprintf("recipe-api-backup-%s.jsonl.gz", time.Now().UTC().Format("20060102-150405"))
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	opts := models.BackupOptions{IncludePasswordHashes: includeHashes}
+	if err := adh.backupStorage.Dump(r.Context(), w, version, opts); err != nil {
+		// Headers are already sent, so the truncated archive is all we can give
+		slog.ErrorContext(r.Context(), "Backup failed", "error", err)
+	}
+}
+
+// HandleRestore handles requests to /api/admin/restore (POST), replacing the
+// database contents with the backup archive in the request body. Every login
+// session is ended afterwards, since it may belong to a user the archive
+// removed or changed.
+func (adh *AdminHandler) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	version, err := adh.schemaVersion(r.Context())
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get schema version")
+		return
+	}
+
+	summary, err := adh.backupStorage.Restore(r.Context(), http.MaxBytesReader(w, r.Body, maxRestoreBodyBytes), version)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			sendError(w, r, fmt.Sprintf("Backup archive is larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		sendStorageError(w, r, err, "Restore failed")
+		return
+	}
+
+	sessions := adh.authService.InvalidateAll()
+	slog.InfoContext(r.Context(), "Ended login sessions after restore", "sessions", sessions)
+
+	sendSuccess(w, r, "Backup restored successfully", summary, http.StatusOK)
+}
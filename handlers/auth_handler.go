@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"recipe-api/auth"
+	"recipe-api/metrics"
 	"recipe-api/models"
+	"recipe-api/storage"
 	"strings"
 )
 
@@ -21,147 +24,116 @@ func NewAuthHandler(authService *auth.AuthService) *AuthHandler {
 	}
 }
 
+// RegisterRoutes registers the login and logout routes on api
+func (ah *AuthHandler) RegisterRoutes(api *API) {
+	api.Handle("/login", Routes{"POST": ah.HandleLogin})
+	api.Handle("/logout", Routes{"POST": ah.HandleLogout})
+}
+
 // HandleLogin processes login requests
 func (ah *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-	w.Header().Set("Content-Type", "application/json")
-
-	// Handle preflight requests
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	if r.Method != "POST" {
-		ah.sendLoginError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Parse request body
 	var loginReq models.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
-		ah.sendLoginError(w, "Invalid JSON format", http.StatusBadRequest)
+		sendError(w, r, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
 
 	// Validate required fields
 	if loginReq.Username == "" || loginReq.Password == "" {
-		ah.sendLoginError(w, "Username and password are required", http.StatusBadRequest)
+		sendError(w, r, "Username and password are required", http.StatusBadRequest)
 		return
 	}
 
 	// Validate credentials
-	user, valid := ah.authService.ValidateCredentials(loginReq.Username, loginReq.Password)
-	if !valid {
-		ah.sendLoginError(w, "Invalid username or password", http.StatusUnauthorized)
+	user, err := ah.authService.ValidateCredentials(r.Context(), loginReq.Username, loginReq.Password)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCredentials) {
+			metrics.ObserveLogin(metrics.LoginFailure)
+			sendError(w, r, "Invalid username or password", http.StatusUnauthorized)
+			return
+		}
+		sendStorageError(w, r, err, "Failed to check credentials")
 		return
 	}
 
 	// Generate token
 	token, err := ah.authService.GenerateToken(user)
 	if err != nil {
-		ah.sendLoginError(w, "Failed to generate token", http.StatusInternalServerError)
+		sendError(w, r, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
-	// Send success response
-	response := models.LoginResponse{
-		Success: true,
-		Message: "Login successful",
-		Token:   token,
-	}
+	metrics.ObserveLogin(metrics.LoginSuccess)
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	sendSuccess(w, r, "Login successful", models.LoginResponse{Token: token}, http.StatusOK)
 }
 
 // HandleLogout processes logout requests
 func (ah *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-	w.Header().Set("Content-Type", "application/json")
-
-	// Handle preflight requests
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	if r.Method != "POST" {
-		ah.sendLoginError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Extract token from Authorization header
 	token := ah.extractTokenFromHeader(r)
 	if token == "" {
-		ah.sendLoginError(w, "Authorization token required", http.StatusUnauthorized)
+		sendError(w, r, "Authorization token required", http.StatusUnauthorized)
 		return
 	}
 
 	// Validate token exists
 	_, valid := ah.authService.ValidateToken(token)
 	if !valid {
-		ah.sendLoginError(w, "Invalid or expired token", http.StatusUnauthorized)
+		sendError(w, r, "Invalid or expired token", http.StatusUnauthorized)
 		return
 	}
 
 	// Invalidate token
 	if ah.authService.InvalidateToken(token) {
-		response := models.LoginResponse{
-			Success: true,
-			Message: "Logout successful",
-		}
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(response)
+		sendSuccess(w, r, "Logout successful", nil, http.StatusOK)
 	} else {
-		ah.sendLoginError(w, "Failed to logout", http.StatusInternalServerError)
+		sendError(w, r, "Failed to logout", http.StatusInternalServerError)
 	}
 }
 
 // AuthMiddleware validates authentication for protected routes
 func (ah *AuthHandler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Content-Type", "application/json")
-
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
 		// Extract token from Authorization header
 		token := ah.extractTokenFromHeader(r)
 		if token == "" {
-			ah.sendLoginError(w, "Authorization token required", http.StatusUnauthorized)
+			sendError(w, r, "Authorization token required", http.StatusUnauthorized)
 			return
 		}
 
 		// Validate token
 		tokenInfo, valid := ah.authService.ValidateToken(token)
 		if !valid {
-			ah.sendLoginError(w, "Invalid or expired token", http.StatusUnauthorized)
+			sendError(w, r, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
 		// Add user info to request context (optional, for logging)
 		r.Header.Set("X-Username", tokenInfo.Username)
 		r.Header.Set("X-User-ID", fmt.Sprintf("%d", tokenInfo.UserID))
+		r.Header.Set("X-Is-Admin", fmt.Sprintf("%t", tokenInfo.IsAdmin))
+		setRequestUser(r, tokenInfo.UserID)
 
 		// Call next handler
 		next(w, r)
 	}
 }
 
+// AdminMiddleware validates authentication and requires an administrator
+func (ah *AuthHandler) AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return ah.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Is-Admin") != "true" {
+			sendError(w, r, "Administrator access required", http.StatusForbidden)
+			return
+		}
+
+		// Call next handler
+		next(w, r)
+	})
+}
+
 // extractTokenFromHeader extracts Bearer token from Authorization header
 func (ah *AuthHandler) extractTokenFromHeader(r *http.Request) string {
 	authHeader := r.Header.Get("Authorization")
@@ -176,13 +148,3 @@ func (ah *AuthHandler) extractTokenFromHeader(r *http.Request) string {
 
 	return ""
 }
-
-// sendLoginError sends an authentication error response
-func (ah *AuthHandler) sendLoginError(w http.ResponseWriter, message string, statusCode int) {
-	response := models.LoginResponse{
-		Success: false,
-		Error:   message,
-	}
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(response)
-}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"recipe-api/auth"
+	"recipe-api/models"
+	"time"
+)
+
+// readinessCheckTimeout bounds each database call made by /readyz
+const readinessCheckTimeout = 2 * time.Second
+
+// HealthHandler serves the liveness and readiness probes and the
+// administrators' status report
+type HealthHandler struct {
+	db                    *sql.DB
+	authService           *auth.AuthService
+	schemaVersion         func(context.Context) (uint, error)
+	expectedSchemaVersion uint
+	workersRunning        func() bool
+	version               string
+	startedAt             time.Time
+}
+
+// NewHealthHandler creates a new health handler. schemaVersion reports the
+// migration version the database is at, which must equal
+// expectedSchemaVersion for the server to be ready, and workersRunning
+// reports whether the background jobs are running. version is the build
+// version shown in the status report.
+func NewHealthHandler(db *sql.DB, authService *auth.AuthService, schemaVersion func(context.Context) (uint, error),
+	expectedSchemaVersion uint, workersRunning func() bool, version string) *HealthHandler {
+	return &HealthHandler{
+		db:                    db,
+		authService:           authService,
+		schemaVersion:         schemaVersion,
+		expectedSchemaVersion: expectedSchemaVersion,
+		workersRunning:        workersRunning,
+		version:               version,
+		startedAt:             time.Now(),
+	}
+}
+
+// RegisterProbes registers /healthz and /readyz on mux. They need no login
+// and are not versioned, so orchestrators can rely on them.
+func (hh *HealthHandler) RegisterProbes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", hh.HandleHealthz)
+	mux.HandleFunc("GET /readyz", hh.HandleReadyz)
+}
+
+// RegisterRoutes registers the status route on api. protect wraps the route
+// and must require an administrator.
+func (hh *HealthHandler) RegisterRoutes(api *API, protect func(http.HandlerFunc) http.HandlerFunc) {
+	api.Handle("/admin/status", Routes{"GET": protect(hh.getStatus)})
+}
+
+// HandleHealthz handles GET /healthz. It answers as long as the process is
+// serving requests.
+func (hh *HealthHandler) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// HandleReadyz handles GET /readyz, reporting 200 if the database answers a
+// ping, is migrated to the expected version and the background jobs are
+// running, and 503 with the failing checks otherwise
+func (hh *HealthHandler) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	readiness := models.Readiness{
+		Checks: []models.ReadinessCheck{
+			check("database", hh.pingDatabase(r.Context())),
+			check("migrations", hh.checkSchemaVersion(r.Context())),
+			check("background_jobs", hh.checkWorkers()),
+		},
+	}
+
+	readiness.Ready = true
+	for _, c := range readiness.Checks {
+		readiness.Ready = readiness.Ready && c.OK
+	}
+
+	statusCode := http.StatusOK
+	if !readiness.Ready {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(readiness)
+}
+
+// check turns the error from a readiness check into its result
+func check(name string, err error) models.ReadinessCheck {
+	if err != nil {
+		return models.ReadinessCheck{Name: name, Error: err.Error()}
+	}
+	return models.ReadinessCheck{Name: name, OK: true}
+}
+
+// pingDatabase checks that the database answers within readinessCheckTimeout.
+// The driver's error is logged rather than returned, since /readyz is public.
+func (hh *HealthHandler) pingDatabase(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+	if err := hh.db.PingContext(ctx); err != nil {
+		slog.WarnContext(ctx, "Readiness check: database ping failed", "error", err)
+		return fmt.Errorf("database did not answer a ping")
+	}
+	return nil
+}
+
+// checkSchemaVersion checks that the database is at the expected migration
+// version, reading it within readinessCheckTimeout
+func (hh *HealthHandler) checkSchemaVersion(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+	version, err := hh.schemaVersion(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Readiness check: failed to get schema version", "error", err)
+		return fmt.Errorf("schema version could not be read")
+	}
+	if version != hh.expectedSchemaVersion {
+		return fmt.Errorf("database is at version %d, expected %d", version, hh.expectedSchemaVersion)
+	}
+	return nil
+}
+
+// checkWorkers checks that the background jobs are running
+func (hh *HealthHandler) checkWorkers() error {
+	if !hh.workersRunning() {
+		return fmt.Errorf("background jobs are not running")
+	}
+	return nil
+}
+
+// getStatus handles GET /api/admin/status
+func (hh *HealthHandler) getStatus(w http.ResponseWriter, r *http.Request) {
+	version, err := hh.schemaVersion(r.Context())
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get schema version")
+		return
+	}
+
+	stats := hh.db.Stats()
+	status := models.ServerStatus{
+		Version:               hh.version,
+		StartedAt:             hh.startedAt,
+		UptimeSeconds:         int64(time.Since(hh.startedAt).Seconds()),
+		SchemaVersion:         version,
+		ExpectedSchemaVersion: hh.expectedSchemaVersion,
+		ActiveSessions:        hh.authService.GetActiveTokensCount(),
+		BackgroundJobsRunning: hh.workersRunning(),
+		Database: models.DatabasePoolStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDurationMillis: stats.WaitDuration.Milliseconds(),
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		},
+	}
+
+	sendSuccess(w, r, "Status retrieved successfully", status, http.StatusOK)
+}
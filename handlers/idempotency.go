@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"recipe-api/models"
+)
+
+// maxIdempotencyKeyLength limits the length of Idempotency-Key headers
+const maxIdempotencyKeyLength = 255
+
+// responseRecorder passes a response through while keeping a copy of its
+// status code and body
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+// WriteHeader records the status code and sends it on
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	if rr.statusCode == 0 {
+		rr.statusCode = statusCode
+	}
+	rr.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records the body and sends it on
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	if rr.statusCode == 0 {
+		rr.statusCode = http.StatusOK
+	}
+	rr.body.Write(data)
+	return rr.ResponseWriter.Write(data)
+}
+
+// idempotent wraps next so that it runs unless the request repeats an earlier one with the
+// same Idempotency-Key, in which case the earlier response is replayed.
+// Reusing a key with a different body is rejected with 422, and a key whose
+// request is still running with 409. Responses with a 5xx status are not
+// kept, so a retry after a server error runs the request again.
+func (rh *RecipeHandler) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rh.serveIdempotently(w, r, next)
+	}
+}
+
+// serveIdempotently runs next for a request, as described for idempotent
+func (rh *RecipeHandler) serveIdempotently(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	key := r.Header.Get("Idempotency-Key")
+	userID := getUserIDFromRequest(r)
+	if key == "" || userID == nil {
+		next(w, r)
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		sendError(w, r, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength), http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBodyBytes))
+	if err != nil {
+		sendError(w, r, fmt.Sprintf("Failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	hash := sha256.Sum256(body)
+	requestHash := hex.EncodeToString(hash[:])
+
+	record, err := rh.idempotencyStorage.ReserveIdempotencyKey(r.Context(), *userID, key, requestHash)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to check Idempotency-Key")
+		return
+	}
+
+	if record != nil {
+		switch {
+		case record.RequestHash != requestHash:
+			sendErrorCode(w, r, models.CodeIdempotencyKeyReused, "Idempotency-Key has already been used with a different request body", http.StatusUnprocessableEntity)
+		case !record.IsComplete():
+			sendError(w, r, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+		default:
+			// The body is replayed as stored, so a problem keeps the
+			// request_id of the original request
+			if record.ETag != "" {
+				w.Header().Set("ETag", record.ETag)
+			}
+			if record.ContentType != "" {
+				w.Header().Set("Content-Type", record.ContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.ResponseBody)
+		}
+		return
+	}
+
+	// The key must be released or completed even if the client has gone
+	// away or the request has run out of time
+	ctx := context.WithoutCancel(r.Context())
+
+	recorder := &responseRecorder{ResponseWriter: w}
+	completed := false
+	defer func() {
+		// Free the key if the request failed or panicked so it can be retried
+		if !completed {
+			if err := rh.idempotencyStorage.ReleaseIdempotencyKey(ctx, *userID, key); err != nil {
+				slog.ErrorContext(ctx, "Failed to release Idempotency-Key", "error", err)
+			}
+		}
+	}()
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	next(recorder, r)
+
+	if recorder.statusCode == 0 || recorder.statusCode >= 500 || recorder.statusCode == statusClientClosedRequest {
+		return
+	}
+
+	record = &models.IdempotencyRecord{
+		UserID:       *userID,
+		Key:          key,
+		RequestHash:  requestHash,
+		StatusCode:   recorder.statusCode,
+		ETag:         w.Header().Get("ETag"),
+		ContentType:  w.Header().Get("Content-Type"),
+		ResponseBody: recorder.body.Bytes(),
+	}
+	if err := rh.idempotencyStorage.CompleteIdempotencyKey(ctx, *record); err != nil {
+		slog.ErrorContext(ctx, "Failed to store response for Idempotency-Key", "error", err)
+		return
+	}
+	completed = true
+}
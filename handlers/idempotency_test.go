@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"recipe-api/models"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryIdempotencyStorage keeps idempotency records in memory
+type memoryIdempotencyStorage struct {
+	mutex   sync.Mutex
+	records map[string]models.IdempotencyRecord
+}
+
+func newMemoryIdempotencyStorage() *memoryIdempotencyStorage {
+	return &memoryIdempotencyStorage{records: make(map[string]models.IdempotencyRecord)}
+}
+
+func recordKey(userID int, key string) string {
+	return fmt.Sprintf("%d:%s", userID, key)
+}
+
+func (ms *memoryIdempotencyStorage) ReserveIdempotencyKey(ctx context.Context, userID int, key, requestHash string) (*models.IdempotencyRecord, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if record, ok := ms.records[recordKey(userID, key)]; ok {
+		return &record, nil
+	}
+	ms.records[recordKey(userID, key)] = models.IdempotencyRecord{UserID: userID, Key: key, RequestHash: requestHash}
+	return nil, nil
+}
+
+func (ms *memoryIdempotencyStorage) CompleteIdempotencyKey(ctx context.Context, record models.IdempotencyRecord) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.records[recordKey(record.UserID, record.Key)] = record
+	return nil
+}
+
+func (ms *memoryIdempotencyStorage) ReleaseIdempotencyKey(ctx context.Context, userID int, key string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	delete(ms.records, recordKey(userID, key))
+	return nil
+}
+
+func (ms *memoryIdempotencyStorage) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+// idempotentRequest is one request sent through RecipeHandler.idempotent
+// and the response expected for it
+type idempotentRequest struct {
+	userID string
+	key    string
+	body   string
+
+	wantStatus      int
+	wantRan         bool
+	wantReplayed    bool
+	wantContentType string
+	wantBody        string
+}
+
+func TestIdempotent(t *testing.T) {
+	created := `{"id":"r1"}` + "\n"
+
+	tests := []struct {
+		name string
+		// status is the status code the wrapped handler responds with
+		status   int
+		seed     func(*memoryIdempotencyStorage)
+		requests []idempotentRequest
+	}{
+		{
+			name:   "requests without a key always run",
+			status: http.StatusCreated,
+			requests: []idempotentRequest{
+				{userID: "1", body: "{}", wantStatus: http.StatusCreated, wantRan: true, wantContentType: "application/json", wantBody: created},
+				{userID: "1", body: "{}", wantStatus: http.StatusCreated, wantRan: true, wantContentType: "application/json", wantBody: created},
+			},
+		},
+		{
+			name:   "retries are replayed",
+			status: http.StatusCreated,
+			requests: []idempotentRequest{
+				{userID: "1", key: "k", body: "{}", wantStatus: http.StatusCreated, wantRan: true, wantContentType: "application/json", wantBody: created},
+				{userID: "1", key: "k", body: "{}", wantStatus: http.StatusCreated, wantReplayed: true, wantContentType: "application/json", wantBody: created},
+				{userID: "1", key: "k", body: "{}", wantStatus: http.StatusCreated, wantReplayed: true, wantContentType: "application/json", wantBody: created},
+			},
+		},
+		{
+			name:   "client errors are replayed",
+			status: http.StatusBadRequest,
+			requests: []idempotentRequest{
+				{userID: "1", key: "k", body: "{}", wantStatus: http.StatusBadRequest, wantRan: true, wantContentType: "application/json", wantBody: created},
+				{userID: "1", key: "k", body: "{}", wantStatus: http.StatusBadRequest, wantReplayed: true, wantContentType: "application/json", wantBody: created},
+			},
+		},
+		{
+			name:   "server errors are not kept",
+			status: http.StatusInternalServerError,
+			requests: []idempotentRequest{
+				{userID: "1", key: "k", body: "{}", wantStatus: http.StatusInternalServerError, wantRan: true, wantContentType: "application/json", wantBody: created},
+				{userID: "1", key: "k", body: "{}", wantStatus: http.StatusInternalServerError, wantRan: true, wantContentType: "application/json", wantBody: created},
+			},
+		},
+		{
+			name:   "key reused with a different body",
+			status: http.StatusCreated,
+			requests: []idempotentRequest{
+				{userID: "1", key: "k", body: `{"name":"a"}`, wantStatus: http.StatusCreated, wantRan: true, wantContentType: "application/json", wantBody: created},
+				{userID: "1", key: "k", body: `{"name":"b"}`, wantStatus: http.StatusUnprocessableEntity, wantContentType: models.ProblemContentType},
+			},
+		},
+		{
+			name:   "keys are per user",
+			status: http.StatusCreated,
+			requests: []idempotentRequest{
+				{userID: "1", key: "k", body: "{}", wantStatus: http.StatusCreated, wantRan: true, wantContentType: "application/json", wantBody: created},
+				{userID: "2", key: "k", body: "{}", wantStatus: http.StatusCreated, wantRan: true, wantContentType: "application/json", wantBody: created},
+			},
+		},
+		{
+			name:   "request still in progress",
+			status: http.StatusCreated,
+			seed: func(ms *memoryIdempotencyStorage) {
+				hash := sha256.Sum256([]byte("{}"))
+				ms.records[recordKey(1, "k")] = models.IdempotencyRecord{UserID: 1, Key: "k", RequestHash: hex.EncodeToString(hash[:])}
+			},
+			requests: []idempotentRequest{
+				{userID: "1", key: "k", body: "{}", wantStatus: http.StatusConflict, wantContentType: models.ProblemContentType},
+			},
+		},
+		{
+			name:   "key too long",
+			status: http.StatusCreated,
+			requests: []idempotentRequest{
+				{userID: "1", key: strings.Repeat("k", maxIdempotencyKeyLength+1), body: "{}", wantStatus: http.StatusBadRequest, wantContentType: models.ProblemContentType},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newMemoryIdempotencyStorage()
+			if tt.seed != nil {
+				tt.seed(storage)
+			}
+			rh := NewRecipeHandler(nil, nil, nil, storage)
+
+			ran := false
+			handler := rh.idempotent(func(w http.ResponseWriter, r *http.Request) {
+				ran = true
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("ETag", `"1-abc"`)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(created))
+			})
+
+			for i, req := range tt.requests {
+				ran = false
+				r := httptest.NewRequest(http.MethodPost, "/api/v1/recipes", strings.NewReader(req.body))
+				r.Header.Set("X-User-ID", req.userID)
+				if req.key != "" {
+					r.Header.Set("Idempotency-Key", req.key)
+				}
+				w := httptest.NewRecorder()
+				handler(w, r)
+
+				if w.Code != req.wantStatus {
+					t.Errorf("request %d: status = %d, want %d", i, w.Code, req.wantStatus)
+				}
+				if ran != req.wantRan {
+					t.Errorf("request %d: handler ran = %v, want %v", i, ran, req.wantRan)
+				}
+				if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != req.wantReplayed {
+					t.Errorf("request %d: replayed = %v, want %v", i, replayed, req.wantReplayed)
+				}
+				if got := w.Header().Get("Content-Type"); got != req.wantContentType {
+					t.Errorf("request %d: Content-Type = %q, want %q", i, got, req.wantContentType)
+				}
+				if req.wantBody != "" {
+					if got := w.Body.String(); got != req.wantBody {
+						t.Errorf("request %d: body = %q, want %q", i, got, req.wantBody)
+					}
+					if got := w.Header().Get("ETag"); got != `"1-abc"` {
+						t.Errorf("request %d: ETag = %q, want %q", i, got, `"1-abc"`)
+					}
+				}
+			}
+		})
+	}
+}
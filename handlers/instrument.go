@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"recipe-api/logging"
+	"recipe-api/metrics"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID that correlates a request with its log
+// lines. A client may send one; otherwise the server assigns it. Either way
+// it is echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits the length of client-sent request IDs
+const maxRequestIDLength = 128
+
+// tracer creates the spans of requests
+var tracer = otel.Tracer("recipe-api/handlers")
+
+// WithRequestID gives every request an ID: the client's X-Request-ID if it
+// is short and printable, or a new UUID. The ID is set on the response
+// header before next runs and carried in the request's context, where
+// logging picks it up.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether a client-sent request ID can be used as is
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// statusWriter passes a response through while noting its status code and
+// size. Unwrap lets http.ResponseController reach the underlying writer, so
+// flushing and deadline changes still work through it.
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int64
+}
+
+// WriteHeader records the status code and sends it on
+func (sw *statusWriter) WriteHeader(statusCode int) {
+	if sw.statusCode == 0 {
+		sw.statusCode = statusCode
+	}
+	sw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records an implicit 200 and the body size and sends the body on
+func (sw *statusWriter) Write(data []byte) (int, error) {
+	if sw.statusCode == 0 {
+		sw.statusCode = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(data)
+	sw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying ResponseWriter
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// requestUserKey is the context key for the requestUser of a request
+type requestUserKey struct{}
+
+// requestUser is where AuthMiddleware leaves the ID of the logged in user
+// for the access log, which is written after the handlers have returned
+type requestUser struct {
+	id int
+}
+
+// setRequestUser records the logged in user of r for its access log line
+func setRequestUser(r *http.Request, userID int) {
+	if user, ok := r.Context().Value(requestUserKey{}).(*requestUser); ok {
+		user.id = userID
+	}
+}
+
+// Instrument wraps next so that each request it serves is traced, counted,
+// timed and written to the access log under route, the pattern next was
+// registered with. Using the pattern rather than the path keeps the number
+// of metric label values bounded. The request's span continues the trace
+// named by a W3C traceparent header, if there is one, and storage calls made
+// while serving it become its children.
+func Instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		user := &requestUser{}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				attribute.String("request.id", logging.RequestID(ctx)),
+			))
+		r = r.WithContext(context.WithValue(ctx, requestUserKey{}, user))
+
+		defer func() {
+			duration := time.Since(start)
+			statusCode := sw.statusCode
+			if statusCode == 0 {
+				statusCode = http.StatusOK
+			}
+			metrics.ObserveRequest(route, r.Method, statusCode, duration)
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(statusCode))
+			if user.id != 0 {
+				span.SetAttributes(semconv.EnduserID(strconv.Itoa(user.id)))
+			}
+			if statusCode >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(statusCode))
+			}
+			span.End()
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("route", route),
+				slog.Int("status", statusCode),
+				slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+				slog.Int64("bytes", sw.bytes),
+			}
+			if user.id != 0 {
+				attrs = append(attrs, slog.Int("user_id", user.id))
+			}
+			slog.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+		}()
+
+		next.ServeHTTP(sw, r)
+	})
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"recipe-api/models"
+	"recipe-api/storage"
+	"strconv"
+	"strings"
+)
+
+// PantryHandler handles HTTP requests for the current user's pantry
+type PantryHandler struct {
+	storage storage.PantryStorage
+}
+
+// NewPantryHandler creates a new pantry handler
+func NewPantryHandler(storage storage.PantryStorage) *PantryHandler {
+	return &PantryHandler{
+		storage: storage,
+	}
+}
+
+// RegisterRoutes registers the pantry routes on api. protect wraps the
+// routes that require an authenticated user.
+func (ph *PantryHandler) RegisterRoutes(api *API, protect func(http.HandlerFunc) http.HandlerFunc) {
+	api.Handle("/pantry", Routes{
+		"GET":  protect(ph.withUser(ph.getPantryItems)),
+		"POST": protect(ph.withUser(ph.savePantryItem)),
+	})
+	api.Handle("/pantry/{id}", Routes{
+		"DELETE": protect(ph.withUser(ph.deletePantryItem)),
+	})
+}
+
+// withUser adapts a handler taking the authenticated user's ID
+func (ph *PantryHandler) withUser(next func(w http.ResponseWriter, r *http.Request, userID int)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := getUserIDFromRequest(r)
+		if userID == nil {
+			sendError(w, r, "Authenticated user required", http.StatusUnauthorized)
+			return
+		}
+		next(w, r, *userID)
+	}
+}
+
+// getPantryItems handles GET /api/pantry
+func (ph *PantryHandler) getPantryItems(w http.ResponseWriter, r *http.Request, userID int) {
+	items, err := ph.storage.GetPantryItems(r.Context(), userID)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get pantry items")
+		return
+	}
+
+	sendSuccess(w, r, "Pantry items retrieved successfully", items, http.StatusOK)
+}
+
+// savePantryItem handles POST /api/pantry
+func (ph *PantryHandler) savePantryItem(w http.ResponseWriter, r *http.Request, userID int) {
+	var item models.PantryItem
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		sendErrorCode(w, r, models.CodeInvalidJSON, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	item.UserID = userID
+	item.Ingredient = strings.TrimSpace(item.Ingredient)
+
+	if err := ph.storage.SavePantryItem(r.Context(), &item); err != nil {
+		sendStorageError(w, r, err, "Failed to save pantry item")
+		return
+	}
+
+	sendSuccess(w, r, "Pantry item saved successfully", item, http.StatusCreated)
+}
+
+// deletePantryItem handles DELETE /api/pantry/{id}
+func (ph *PantryHandler) deletePantryItem(w http.ResponseWriter, r *http.Request, userID int) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		sendErrorCode(w, r, models.CodeInvalidID, "Invalid pantry item ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := ph.storage.DeletePantryItem(r.Context(), id, userID); err != nil {
+		sendStorageError(w, r, err, "Failed to delete pantry item")
+		return
+	}
+
+	sendSuccess(w, r, "Pantry item deleted successfully", nil, http.StatusOK)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"recipe-api/models"
+	"recipe-api/storage"
+)
+
+// retryAfterSeconds is the Retry-After sent with 503 responses
+const retryAfterSeconds = "5"
+
+// statusClientClosedRequest is the non-standard status sent when
+// the client goes away before its request is answered. net/http has no
+// constant or status text for it.
+const statusClientClosedRequest = 499
+
+// statusCodes maps HTTP status codes to the error code used when a handler
+// does not give a more specific one
+var statusCodes = map[int]string{
+	http.StatusBadRequest:           models.CodeBadRequest,
+	http.StatusUnauthorized:         models.CodeUnauthorized,
+	http.StatusForbidden:            models.CodeForbidden,
+	http.StatusNotFound:             models.CodeNotFound,
+	http.StatusMethodNotAllowed:     models.CodeMethodNotAllowed,
+	http.StatusNotAcceptable:        models.CodeNotAcceptable,
+	http.StatusConflict:             models.CodeConflict,
+	http.StatusPreconditionFailed:   models.CodePreconditionFailed,
+	http.StatusUnsupportedMediaType: models.CodeUnsupportedMediaType,
+	http.StatusInternalServerError:  models.CodeInternalError,
+	http.StatusServiceUnavailable:   models.CodeServiceUnavailable,
+	http.StatusGatewayTimeout:       models.CodeTimeout,
+	statusClientClosedRequest:       models.CodeClientClosedRequest,
+}
+
+// sendError sends a problem details response with the error code for the
+// status code
+func sendError(w http.ResponseWriter, r *http.Request, message string, statusCode int) {
+	code, ok := statusCodes[statusCode]
+	if !ok {
+		code = models.CodeBadRequest
+		if statusCode >= 500 {
+			code = models.CodeInternalError
+		}
+	}
+	sendErrorCode(w, r, code, message, statusCode)
+}
+
+// sendErrorCode sends a problem details response with a specific error code
+func sendErrorCode(w http.ResponseWriter, r *http.Request, code, message string, statusCode int) {
+	sendProblem(w, r, models.Problem{Status: statusCode, Code: code, Detail: message})
+}
+
+// sendProblem sends a problem through the Responder of the API r arrived on
+func sendProblem(w http.ResponseWriter, r *http.Request, problem models.Problem) {
+	responderFor(r).Problem(w, problem)
+}
+
+// sendValidationError sends the 400 validation_failed problem listing what
+// is wrong with which field, for input rejected by a handler or by storage
+func sendValidationError(w http.ResponseWriter, r *http.Request, message string, fields []models.FieldError) {
+	sendProblem(w, r, models.Problem{
+		Status: http.StatusBadRequest,
+		Code:   models.CodeValidationFailed,
+		Detail: message,
+		Errors: fields,
+	})
+}
+
+// fieldErrors returns the field errors reported by a Validate method, or err
+// as a single error with no field if it is not a models.FieldErrors
+func fieldErrors(err error) []models.FieldError {
+	var fields models.FieldErrors
+	if errors.As(err, &fields) {
+		return fields
+	}
+	return []models.FieldError{{Message: err.Error()}}
+}
+
+// sendStorageError sends the problem details response for an error returned
+// by storage while serving r. Missing records, conflicting writes, invalid
+// records and version mismatches get their own status and code, an
+// unreachable database gets 503, a storage call cut short because the client
+// went away gets 499 and one that ran out of time gets 504. Any other error
+// is logged and reported as a 500 with only message as the detail, so that
+// database error text never reaches the client. Log lines carry the request
+// ID from r's context, matching the request_id in the response.
+func sendStorageError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	var invalid *storage.ValidationError
+
+	switch {
+	case errors.Is(r.Context().Err(), context.Canceled) || errors.Is(err, context.Canceled):
+		slog.InfoContext(r.Context(), message+": client closed request", "error", err)
+		sendErrorCode(w, r, models.CodeClientClosedRequest, message+": request cancelled", statusClientClosedRequest)
+	case storage.IsTimeout(err):
+		slog.WarnContext(r.Context(), message+": timed out", "error", err)
+		sendErrorCode(w, r, models.CodeTimeout, message+": timed out", http.StatusGatewayTimeout)
+	case errors.Is(err, storage.ErrNotFound):
+		sendErrorCode(w, r, models.CodeNotFound, err.Error(), http.StatusNotFound)
+	case errors.Is(err, storage.ErrForbidden):
+		sendErrorCode(w, r, models.CodeForbidden, "Only the owner can change this recipe", http.StatusForbidden)
+	case errors.Is(err, storage.ErrConflict):
+		sendErrorCode(w, r, models.CodeConflict, err.Error(), http.StatusConflict)
+	case errors.Is(err, storage.ErrVersionMismatch):
+		sendErrorCode(w, r, models.CodePreconditionFailed, "Recipe has been modified; fetch it again and retry", http.StatusPreconditionFailed)
+	case errors.As(err, &invalid):
+		sendValidationError(w, r, "Validation error: "+models.FieldErrors(invalid.Fields).Error(), invalid.Fields)
+	case storage.IsUnavailable(err):
+		slog.ErrorContext(r.Context(), message+": database unavailable", "error", err)
+		w.Header().Set("Retry-After", retryAfterSeconds)
+		sendErrorCode(w, r, models.CodeServiceUnavailable, message+": database unavailable", http.StatusServiceUnavailable)
+	default:
+		slog.ErrorContext(r.Context(), message, "error", err)
+		sendErrorCode(w, r, models.CodeInternalError, message, http.StatusInternalServerError)
+	}
+}
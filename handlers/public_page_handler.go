@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"recipe-api/models"
+	"recipe-api/recipeformat"
+	"recipe-api/storage"
+)
+
+// PublicPageHandler serves server-rendered HTML pages for public recipes
+type PublicPageHandler struct {
+	storage  storage.RecipeStorage
+	template *template.Template
+}
+
+// recipePageData is the data passed to the recipe page template
+type recipePageData struct {
+	Recipe models.Recipe
+	Steps  []string
+	JSONLD template.JS
+}
+
+// NewPublicPageHandler creates a new public page handler using the recipe page template at templatePath
+func NewPublicPageHandler(storage storage.RecipeStorage, templatePath string) (*PublicPageHandler, error) {
+	tmpl, err := template.ParseFiles(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse recipe page template: %v", err)
+	}
+
+	return &PublicPageHandler{
+		storage:  storage,
+		template: tmpl,
+	}, nil
+}
+
+// HandleRecipePage handles GET /recipes/{id}, rendering a public
+// recipe as HTML with its schema.org JSON-LD embedded for other tools to consume
+func (pph *PublicPageHandler) HandleRecipePage(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(r, "id")
+	if !ok {
+		pageError(w, "404 page not found", http.StatusNotFound)
+		return
+	}
+
+	recipe, err := pph.storage.GetPublicRecipeByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			pageError(w, "404 page not found", http.StatusNotFound)
+		case storage.IsUnavailable(err):
+			w.Header().Set("Retry-After", retryAfterSeconds)
+			pageError(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+		case storage.IsTimeout(err):
+			slog.WarnContext(r.Context(), "Failed to get public recipe", "error", err)
+			pageError(w, "Timed out loading recipe", http.StatusGatewayTimeout)
+		default:
+			slog.ErrorContext(r.Context(), "Failed to get public recipe", "error", err)
+			pageError(w, "Failed to render recipe", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	jsonLD, err := json.Marshal(recipeformat.ToJSONLD(*recipe))
+	if err != nil {
+		pageError(w, "Failed to render recipe", http.StatusInternalServerError)
+		return
+	}
+
+	data := recipePageData{
+		Recipe: *recipe,
+		Steps:  recipeformat.InstructionSteps(recipe.Instructions),
+		JSONLD: template.JS(jsonLD),
+	}
+
+	var page bytes.Buffer
+	if err := pph.template.Execute(&page, data); err != nil {
+		pageError(w, "Failed to render recipe", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page.Bytes())
+}
+
+// pageError sends a plain text error page that quotes the request ID, so a
+// reader can report it
+func pageError(w http.ResponseWriter, message string, statusCode int) {
+	if id := w.Header().Get(RequestIDHeader); id != "" {
+		message += "\nRequest ID: " + id
+	}
+	http.Error(w, message, statusCode)
+}
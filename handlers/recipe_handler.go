@@ -1,11 +1,19 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
 	"recipe-api/models"
+	"recipe-api/recipeformat"
 	"recipe-api/storage"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -13,233 +21,854 @@ import (
 	"github.com/google/uuid"
 )
 
+// maxImportBodyBytes limits the size of documents accepted by the import endpoint
+const maxImportBodyBytes = 5 << 20
+
 // RecipeHandler handles HTTP requests for recipes
 type RecipeHandler struct {
-	storage storage.RecipeStorage
+	storage            storage.RecipeStorage
+	pantryStorage      storage.PantryStorage
+	duplicateStorage   storage.DuplicateStorage
+	idempotencyStorage storage.IdempotencyStorage
 }
 
 // NewRecipeHandler creates a new recipe handler
-func NewRecipeHandler(storage storage.RecipeStorage) *RecipeHandler {
+func NewRecipeHandler(storage storage.RecipeStorage, pantryStorage storage.PantryStorage,
+	duplicateStorage storage.DuplicateStorage, idempotencyStorage storage.IdempotencyStorage) *RecipeHandler {
 	return &RecipeHandler{
-		storage: storage,
+		storage:            storage,
+		pantryStorage:      pantryStorage,
+		duplicateStorage:   duplicateStorage,
+		idempotencyStorage: idempotencyStorage,
+	}
+}
+
+// RegisterRoutes registers the recipe routes on api. protect wraps the
+// routes that require an authenticated user.
+func (rh *RecipeHandler) RegisterRoutes(api *API, protect func(http.HandlerFunc) http.HandlerFunc) {
+	api.Handle("/recipes", Routes{
+		"GET":  protect(rh.getAllRecipes),
+		"POST": protect(rh.idempotent(rh.createRecipe)),
+		"PUT":  protect(rh.updateRecipeByBody),
+	})
+	api.Handle("/recipes/{id}", Routes{
+		"GET":    protect(rh.withRecipeID(rh.getRecipeByID)),
+		"PUT":    protect(rh.withRecipeID(rh.updateRecipe)),
+		"PATCH":  protect(rh.withRecipeID(rh.patchRecipe)),
+		"DELETE": protect(rh.withRecipeID(rh.deleteRecipe)),
+	})
+
+	// Collection-level actions; literal paths take precedence over {id}
+	api.Handle("/recipes/cookable", Routes{"GET": protect(rh.getCookableRecipes)})
+	api.Handle("/recipes/duplicates", Routes{"GET": protect(rh.getDuplicates)})
+	api.Handle("/recipes/import", Routes{"POST": protect(rh.importRecipe)})
+	api.HandleStreaming("/recipes/export.csv", Routes{"GET": protect(rh.exportCSV)})
+	api.Handle("/recipes/import.csv", Routes{"POST": protect(rh.importCSV)})
+
+	// Recipe subresources
+	api.Handle("/recipes/{id}/fork", Routes{"POST": protect(rh.withRecipeID(rh.forkRecipe))})
+	api.Handle("/recipes/{id}/forks", Routes{"GET": protect(rh.withRecipeID(rh.getForks))})
+	api.Handle("/recipes/{id}/similar", Routes{"GET": protect(rh.withRecipeID(rh.getSimilarRecipes))})
+	api.Handle("/recipes/{id}/merge", Routes{"POST": protect(rh.withRecipeID(rh.mergeRecipe))})
+
+	// Public routes (no login required)
+	api.Handle("/public/recipes/{id}", Routes{"GET": rh.withRecipeID(rh.getPublicRecipe)})
+}
+
+// withRecipeID adapts a handler taking the {id} path wildcard, rejecting
+// requests whose ID is not a UUID with 400
+func (rh *RecipeHandler) withRecipeID(next func(w http.ResponseWriter, r *http.Request, id string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathUUID(r, "id")
+		if !ok {
+			sendErrorCode(w, r, models.CodeInvalidID, "Invalid recipe ID", http.StatusBadRequest)
+			return
+		}
+		next(w, r, id)
 	}
 }
 
-// HandleRecipes handles requests to /api/recipes (GET and POST)
-func (rh *RecipeHandler) HandleRecipes(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-	w.Header().Set("Content-Type", "application/json")
+// getPublicRecipe handles unauthenticated GET /api/public/recipes/{id}
+func (rh *RecipeHandler) getPublicRecipe(w http.ResponseWriter, r *http.Request, id string) {
+	w.Header().Add("Vary", "Accept")
+	format, ok := negotiateFormat(r)
+	if !ok {
+		sendError(w, r, "Requested format is not supported", http.StatusNotAcceptable)
+		return
+	}
+
+	stored, err := rh.storage.GetPublicRecipeByID(r.Context(), id)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get recipe")
+		return
+	}
+	recipe := stored.PublicView()
 
-	// Handle preflight requests
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	if rh.notModified(w, r, &recipe, format) {
 		return
 	}
 
-	switch r.Method {
-	case "GET":
-		rh.getAllRecipes(w, r)
-	case "POST":
-		rh.createRecipe(w, r)
-	case "PUT":
-		rh.updateRecipe(w, r)
-	default:
-		rh.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if format != recipeformat.FormatJSON {
+		rh.sendExport(w, r, recipe, format)
+		return
 	}
+
+	sendSuccess(w, r, "Recipe retrieved successfully", recipe, http.StatusOK)
 }
 
-// HandleRecipeByID handles requests to /api/recipes/{id} (DELETE)
-func (rh *RecipeHandler) HandleRecipeByID(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-	w.Header().Set("Content-Type", "application/json")
+// getAllRecipes handles GET /api/recipes
+func (rh *RecipeHandler) getAllRecipes(w http.ResponseWriter, r *http.Request) {
+	recipes, err := rh.storage.GetAllRecipes(r.Context(), getUserIDFromRequest(r))
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get recipes")
+		return
+	}
+
+	sendSuccess(w, r, "Recipes retrieved successfully", recipes, http.StatusOK)
+}
 
-	// Handle preflight requests
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+// getRecipeByID handles GET /api/recipes/{id}, answering 304 Not Modified
+// when If-None-Match lists the current ETag
+func (rh *RecipeHandler) getRecipeByID(w http.ResponseWriter, r *http.Request, id string) {
+	w.Header().Add("Vary", "Accept")
+	format, ok := negotiateFormat(r)
+	if !ok {
+		sendError(w, r, "Requested format is not supported", http.StatusNotAcceptable)
 		return
 	}
 
-	// Extract ID from URL path
-	path := strings.TrimPrefix(r.URL.Path, "/api/recipes/")
-	if path == "" {
-		rh.sendError(w, "Recipe ID is required", http.StatusBadRequest)
+	recipe, err := rh.storage.GetRecipeByID(r.Context(), id, getUserIDFromRequest(r))
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get recipe")
 		return
 	}
 
-	switch r.Method {
-	case "GET":
-		rh.getRecipeByID(w, r, path)
-	case "DELETE":
-		rh.deleteRecipe(w, r, path)
-	default:
-		rh.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if rh.notModified(w, r, recipe, format) {
+		return
 	}
+
+	if format != recipeformat.FormatJSON {
+		rh.sendExport(w, r, *recipe, format)
+		return
+	}
+
+	sendSuccess(w, r, "Recipe retrieved successfully", recipe, http.StatusOK)
 }
 
-// getAllRecipes handles GET /api/recipes
-func (rh *RecipeHandler) getAllRecipes(w http.ResponseWriter, r *http.Request) {
-	recipes, err := rh.storage.GetAllRecipes()
+// getCookableRecipes handles GET /api/recipes/cookable
+func (rh *RecipeHandler) getCookableRecipes(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDFromRequest(r)
+	if userID == nil {
+		sendError(w, r, "Authenticated user required", http.StatusUnauthorized)
+		return
+	}
+
+	// Optional tolerance: only include recipes missing at most this many ingredients
+	maxMissing := -1
+	if value := r.URL.Query().Get("max_missing"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			sendError(w, r, "max_missing must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		maxMissing = parsed
+	}
+
+	pantry, err := rh.pantryStorage.GetPantryItems(r.Context(), *userID)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get pantry items")
+		return
+	}
+
+	recipes, err := rh.storage.GetAllRecipes(r.Context(), userID)
 	if err != nil {
-		rh.sendError(w, fmt.Sprintf("Failed to get recipes: %v", err), http.StatusInternalServerError)
+		sendStorageError(w, r, err, "Failed to get recipes")
 		return
 	}
 
-	response := models.APIResponse{
-		Success: true,
-		Message: "Recipes retrieved successfully",
-		Data:    recipes,
+	now := time.Now()
+	cookable := []models.CookableRecipe{}
+	for _, recipe := range recipes {
+		match := models.MatchPantry(recipe, pantry, now)
+		if match.MatchedCount == 0 {
+			continue
+		}
+		if maxMissing >= 0 && match.MissingCount > maxMissing {
+			continue
+		}
+		cookable = append(cookable, match)
 	}
 
-	rh.sendJSON(w, response, http.StatusOK)
+	// Rank by most ingredients on hand, then fewest missing
+	sort.SliceStable(cookable, func(i, j int) bool {
+		if cookable[i].MatchedCount != cookable[j].MatchedCount {
+			return cookable[i].MatchedCount > cookable[j].MatchedCount
+		}
+		return cookable[i].MissingCount < cookable[j].MissingCount
+	})
+
+	sendSuccess(w, r, "Cookable recipes retrieved successfully", cookable, http.StatusOK)
 }
 
-// getRecipeByID handles GET /api/recipes/{id}
-func (rh *RecipeHandler) getRecipeByID(w http.ResponseWriter, r *http.Request, id string) {
-	recipe, err := rh.storage.GetRecipeByID(id)
+// forkRecipe handles POST /api/recipes/{id}/fork
+func (rh *RecipeHandler) forkRecipe(w http.ResponseWriter, r *http.Request, id string) {
+	fork, err := rh.storage.ForkRecipe(r.Context(), id, getUserIDFromRequest(r))
 	if err != nil {
-		rh.sendError(w, fmt.Sprintf("Recipe not found: %v", err), http.StatusNotFound)
+		sendStorageError(w, r, err, "Failed to fork recipe")
 		return
 	}
 
-	response := models.APIResponse{
-		Success: true,
-		Message: "Recipe retrieved successfully",
-		Data:    recipe,
+	sendSuccess(w, r, "Recipe forked successfully", fork, http.StatusCreated)
+}
+
+// getForks handles GET /api/recipes/{id}/forks
+func (rh *RecipeHandler) getForks(w http.ResponseWriter, r *http.Request, id string) {
+	userID := getUserIDFromRequest(r)
+
+	// Check the original is visible before listing its forks
+	if _, err := rh.storage.GetRecipeByID(r.Context(), id, userID); err != nil {
+		sendStorageError(w, r, err, "Failed to get recipe")
+		return
 	}
 
-	rh.sendJSON(w, response, http.StatusOK)
+	forks, err := rh.storage.GetForks(r.Context(), id, userID)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get forks")
+		return
+	}
+
+	sendSuccess(w, r, "Forks retrieved successfully", forks, http.StatusOK)
 }
 
-// createRecipe handles POST /api/recipes
-func (rh *RecipeHandler) createRecipe(w http.ResponseWriter, r *http.Request) {
-	var recipe models.Recipe
-	if err := json.NewDecoder(r.Body).Decode(&recipe); err != nil {
-		rh.sendError(w, "Invalid JSON format", http.StatusBadRequest)
+// getSimilarRecipes handles GET /api/recipes/{id}/similar, scoring the other
+// recipes visible to the user against this one
+func (rh *RecipeHandler) getSimilarRecipes(w http.ResponseWriter, r *http.Request, id string) {
+	// Optional cut-off: only include recipes scoring at least this much
+	minScore := 0.5
+	if value := r.URL.Query().Get("min_score"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			sendError(w, r, "min_score must be a number between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		minScore = parsed
+	}
+
+	limit := 10
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			sendError(w, r, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	userID := getUserIDFromRequest(r)
+
+	recipe, err := rh.storage.GetRecipeByID(r.Context(), id, userID)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get recipe")
+		return
+	}
+
+	recipes, err := rh.storage.GetAllRecipes(r.Context(), userID)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get recipes")
 		return
 	}
 
-	// Validate recipe
+	similar := models.FindSimilar(*recipe, recipes, minScore)
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+
+	sendSuccess(w, r, "Similar recipes retrieved successfully", similar, http.StatusOK)
+}
+
+// mergeRecipe handles POST /api/recipes/{id}/merge, folding the recipe named
+// by source_id into this one
+func (rh *RecipeHandler) mergeRecipe(w http.ResponseWriter, r *http.Request, id string) {
+	var req models.MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorCode(w, r, models.CodeInvalidJSON, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if req.SourceID == "" {
+		sendError(w, r, "source_id is required", http.StatusBadRequest)
+		return
+	}
+	if !isUUID(req.SourceID) {
+		sendErrorCode(w, r, models.CodeInvalidID, "Invalid source_id", http.StatusBadRequest)
+		return
+	}
+	if req.SourceID == id {
+		sendError(w, r, "Cannot merge a recipe into itself", http.StatusBadRequest)
+		return
+	}
+
+	userID := getUserIDFromRequest(r)
+
+	// The source is deleted by the merge, so only its owner may merge it
+	source, err := rh.storage.GetRecipeByID(r.Context(), req.SourceID, userID)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get source recipe")
+		return
+	}
+	if !isOwner(source, userID) {
+		sendError(w, r, "Only the owner can merge a recipe away", http.StatusForbidden)
+		return
+	}
+
+	merged, err := rh.storage.MergeRecipe(r.Context(), id, req.SourceID, userID)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to merge recipes")
+		return
+	}
+
+	sendSuccess(w, r, "Recipes merged successfully", merged, http.StatusOK)
+}
+
+// getDuplicates handles GET /api/recipes/duplicates, listing the likely
+// duplicates found by the duplicate detection job
+func (rh *RecipeHandler) getDuplicates(w http.ResponseWriter, r *http.Request) {
+	candidates, err := rh.duplicateStorage.GetDuplicateCandidates(r.Context(), getUserIDFromRequest(r))
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get duplicate candidates")
+		return
+	}
+
+	sendSuccess(w, r, "Duplicate candidates retrieved successfully", candidates, http.StatusOK)
+}
+
+// importRecipe handles POST /api/recipes/import with a schema.org Recipe
+// JSON-LD document or an HTML page containing one
+func (rh *RecipeHandler) importRecipe(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBodyBytes))
+	if err != nil {
+		sendError(w, r, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := recipeformat.ImportDocument(body)
+	if err != nil {
+		sendError(w, r, fmt.Sprintf("Import error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	recipe := &result.Recipe
+	recipe.Visibility = models.VisibilityPrivate
+
+	// Validate the mapped recipe; fields that could not be mapped are reported as invalid
 	if err := recipe.Validate(); err != nil {
-		rh.sendError(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
+		sendValidationError(w, r, fmt.Sprintf("Validation error: %v", err), fieldErrors(err))
 		return
 	}
 
+	// Get user ID from request header
+	userID := getUserIDFromRequest(r)
+
 	// Generate ID and timestamps
 	recipe.ID = uuid.New().String()
 	recipe.CreatedAt = time.Now()
 	recipe.UpdatedAt = time.Now()
+	recipe.CreatedBy = userID
+	recipe.UpdatedBy = userID
+	recipe.Version = 1
+
+	// Save recipe
+	if err := rh.storage.SaveRecipe(r.Context(), *recipe, userID); err != nil {
+		sendStorageError(w, r, err, "Failed to save recipe")
+		return
+	}
+
+	sendSuccess(w, r, "Recipe imported successfully", result, http.StatusCreated)
+}
+
+// exportCSV handles GET /api/recipes/export.csv, streaming every visible recipe
+func (rh *RecipeHandler) exportCSV(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="recipes.csv"`)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(recipeformat.CSVHeader); err != nil {
+		return
+	}
+
+	err := rh.storage.StreamRecipes(r.Context(), getUserIDFromRequest(r), func(recipe models.Recipe) error {
+		if err := recipeformat.WriteCSVRecipe(writer, recipe); err != nil {
+			return err
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		// Headers are already sent, so the truncated file is all we can give
+		slog.ErrorContext(r.Context(), "CSV export failed", "error", err)
+		return
+	}
+
+	writer.Flush()
+}
+
+// importCSV handles POST /api/recipes/import.csv. Every row is validated and
+// the recipes are only saved, all in one transaction, if every row is valid.
+// With ?dry_run=true the rows are validated but nothing is saved.
+func (rh *RecipeHandler) importCSV(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	rows, err := recipeformat.ReadCSVRecipes(http.MaxBytesReader(w, r.Body, maxImportBodyBytes))
+	if err != nil {
+		sendError(w, r, fmt.Sprintf("Import error: %v", err), http.StatusBadRequest)
+		return
+	}
 
 	// Get user ID from request header
-	userID := rh.getUserIDFromRequest(r)
+	userID := getUserIDFromRequest(r)
+
+	report := models.ImportReport{
+		DryRun: dryRun,
+		Total:  len(rows),
+		Errors: []models.ImportRowError{},
+	}
+	recipes := make([]models.Recipe, 0, len(rows))
+	for _, row := range rows {
+		recipe := row.Recipe
+		if recipe.Visibility == "" {
+			recipe.Visibility = models.VisibilityPrivate
+		}
+
+		err := row.Err
+		if err == nil {
+			err = recipe.Validate()
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, models.ImportRowError{Row: row.Row, Error: err.Error()})
+			continue
+		}
+
+		recipe.ID = uuid.New().String()
+		recipe.CreatedBy = userID
+		recipe.UpdatedBy = userID
+		recipes = append(recipes, recipe)
+	}
+
+	if len(report.Errors) > 0 {
+		fields := make([]models.FieldError, len(report.Errors))
+		for i, rowError := range report.Errors {
+			fields[i] = models.FieldError{Field: fmt.Sprintf("row %d", rowError.Row), Message: rowError.Error}
+		}
+		sendValidationError(w, r,
+			fmt.Sprintf("Validation failed for %d of %d rows; nothing was imported", len(report.Errors), report.Total),
+			fields)
+		return
+	}
+
+	if dryRun {
+		sendSuccess(w, r, fmt.Sprintf("Dry run: %d recipes would be imported", len(recipes)), report, http.StatusOK)
+		return
+	}
+
+	if err := rh.storage.ImportRecipes(r.Context(), recipes, userID); err != nil {
+		sendStorageError(w, r, err, "Failed to import recipes")
+		return
+	}
+	report.Imported = len(recipes)
+
+	sendSuccess(w, r, fmt.Sprintf("%d recipes imported successfully", report.Imported), report, http.StatusCreated)
+}
+
+// createRecipe handles POST /api/recipes; see idempotent for retries with an
+// Idempotency-Key
+func (rh *RecipeHandler) createRecipe(w http.ResponseWriter, r *http.Request) {
+	var recipe models.Recipe
+	if err := json.NewDecoder(r.Body).Decode(&recipe); err != nil {
+		sendErrorCode(w, r, models.CodeInvalidJSON, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	// New recipes are private unless stated otherwise
+	if recipe.Visibility == "" {
+		recipe.Visibility = models.VisibilityPrivate
+	}
+
+	// Get user ID from request header
+	userID := getUserIDFromRequest(r)
+
+	// Generate ID and timestamps
+	recipe.ID = uuid.New().String()
+	recipe.CreatedAt = time.Now()
+	recipe.UpdatedAt = time.Now()
+	recipe.CreatedBy = userID
+	recipe.UpdatedBy = userID
+	recipe.ForkedFrom = nil
+	recipe.ForkCount = 0
+	recipe.Version = 1
 
 	// Save recipe
-	if err := rh.storage.SaveRecipe(recipe, userID); err != nil {
-		rh.sendError(w, fmt.Sprintf("Failed to save recipe: %v", err), http.StatusInternalServerError)
+	if err := rh.storage.SaveRecipe(r.Context(), recipe, userID); err != nil {
+		sendStorageError(w, r, err, "Failed to save recipe")
+		return
+	}
+
+	// Read it back so the ETag is computed from what was stored
+	created, err := rh.storage.GetRecipeByID(r.Context(), recipe.ID, userID)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get created recipe")
+		return
+	}
+
+	w.Header().Set("ETag", recipeETag(created, recipeformat.FormatJSON))
+
+	sendSuccess(w, r, "Recipe created successfully", created, http.StatusCreated)
+}
+
+// updateRecipeByBody handles PUT /api/recipes with the recipe ID in the
+// body. It is deprecated in favour of PUT /api/recipes/{id}.
+func (rh *RecipeHandler) updateRecipeByBody(w http.ResponseWriter, r *http.Request) {
+	var recipe models.Recipe
+	if err := json.NewDecoder(r.Body).Decode(&recipe); err != nil {
+		sendErrorCode(w, r, models.CodeInvalidJSON, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
 
-	response := models.APIResponse{
-		Success: true,
-		Message: "Recipe created successfully",
-		Data:    recipe,
+	if !isUUID(recipe.ID) {
+		sendErrorCode(w, r, models.CodeInvalidID, "Invalid recipe ID", http.StatusBadRequest)
+		return
 	}
 
-	rh.sendJSON(w, response, http.StatusCreated)
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", fmt.Sprintf(`<%s/%s>; rel="successor-version"`, r.URL.Path, recipe.ID))
+	rh.saveRecipeUpdate(w, r, recipe)
 }
 
-// updateRecipe handles PUT /api/recipes
-func (rh *RecipeHandler) updateRecipe(w http.ResponseWriter, r *http.Request) {
+// updateRecipe handles PUT /api/recipes/{id}. An ID in the body, if any,
+// must match the one in the URL.
+func (rh *RecipeHandler) updateRecipe(w http.ResponseWriter, r *http.Request, id string) {
 	var recipe models.Recipe
 	if err := json.NewDecoder(r.Body).Decode(&recipe); err != nil {
-		rh.sendError(w, "Invalid JSON format", http.StatusBadRequest)
+		sendErrorCode(w, r, models.CodeInvalidJSON, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
 
+	if recipe.ID != "" && recipe.ID != id {
+		sendError(w, r, "Recipe ID in the body does not match the URL", http.StatusBadRequest)
+		return
+	}
+	recipe.ID = id
+
+	rh.saveRecipeUpdate(w, r, recipe)
+}
+
+// saveRecipeUpdate replaces an existing recipe with the one given; PUT never
+// creates a recipe, so one deleted meanwhile gets 404. With If-Match the
+// update only succeeds if the recipe still has that ETag, otherwise 412.
+func (rh *RecipeHandler) saveRecipeUpdate(w http.ResponseWriter, r *http.Request, recipe models.Recipe) {
+	// Get user ID from request header
+	userID := getUserIDFromRequest(r)
+
 	// Check if recipe exists
-	existingRecipe, err := rh.storage.GetRecipeByID(recipe.ID)
+	existingRecipe, err := rh.storage.GetRecipeByID(r.Context(), recipe.ID, userID)
 	if err != nil {
-		rh.sendError(w, "Recipe not found", http.StatusNotFound)
+		sendStorageError(w, r, err, "Failed to get recipe")
 		return
 	}
 
-	// Validate recipe
-	if err := recipe.Validate(); err != nil {
-		rh.sendError(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
-		return
+	// Without If-Match the client accepts overwriting whatever is stored
+	recipe.Version = 0
+	if r.Header.Get("If-Match") != "" {
+		if !rh.checkIfMatch(w, r, existingRecipe) {
+			return
+		}
+		recipe.Version = existingRecipe.Version
+	}
+
+	// Only the creator may change who can see the recipe
+	if recipe.Visibility == "" || !isOwner(existingRecipe, userID) {
+		recipe.Visibility = existingRecipe.Visibility
+		recipe.SharedWithUsers = existingRecipe.SharedWithUsers
+		recipe.SharedWithGroups = existingRecipe.SharedWithGroups
 	}
 
 	// Keep original creation time, update modification time
 	recipe.CreatedAt = existingRecipe.CreatedAt
+	recipe.CreatedBy = existingRecipe.CreatedBy
+	recipe.ForkedFrom = existingRecipe.ForkedFrom
+	recipe.ForkCount = existingRecipe.ForkCount
 	recipe.UpdatedAt = time.Now()
+	recipe.UpdatedBy = userID
+
+	// Save updated recipe
+	if err := rh.storage.UpdateRecipe(r.Context(), recipe, userID); err != nil {
+		sendStorageError(w, r, err, "Failed to update recipe")
+		return
+	}
+
+	updated, err := rh.storage.GetRecipeByID(r.Context(), recipe.ID, userID)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get updated recipe")
+		return
+	}
+
+	w.Header().Set("ETag", recipeETag(updated, recipeformat.FormatJSON))
+	sendSuccess(w, r, "Recipe updated successfully", updated, http.StatusOK)
+}
+
+// patchRecipe handles PATCH /api/recipes/{id} with an RFC 7396 JSON merge
+// patch. The merged recipe is validated as a whole and only the fields that
+// actually changed are written. The write fails with 412 if the recipe
+// changes after it was read, or if it does not match If-Match.
+func (rh *RecipeHandler) patchRecipe(w http.ResponseWriter, r *http.Request, id string) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != models.MergePatchContentType && mediaType != "application/json") {
+		w.Header().Set("Accept-Patch", models.MergePatchContentType)
+		sendError(w, r, fmt.Sprintf("Content-Type must be %s", models.MergePatchContentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBodyBytes))
+	if err != nil {
+		sendError(w, r, fmt.Sprintf("Failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
 
 	// Get user ID from request header
-	userID := rh.getUserIDFromRequest(r)
+	userID := getUserIDFromRequest(r)
 
-	// Save updated recipe
-	if err := rh.storage.SaveRecipe(recipe, userID); err != nil {
-		rh.sendError(w, fmt.Sprintf("Failed to update recipe: %v", err), http.StatusInternalServerError)
+	existingRecipe, err := rh.storage.GetRecipeByID(r.Context(), id, userID)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get recipe")
 		return
 	}
 
-	response := models.APIResponse{
-		Success: true,
-		Message: "Recipe updated successfully",
-		Data:    recipe,
+	if !rh.checkIfMatch(w, r, existingRecipe) {
+		return
 	}
 
-	rh.sendJSON(w, response, http.StatusOK)
+	recipe, err := models.ApplyMergePatch(*existingRecipe, patch)
+	if err != nil {
+		sendError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changed := models.ChangedFields(*existingRecipe, recipe)
+	if len(changed) == 0 {
+		w.Header().Set("ETag", recipeETag(existingRecipe, recipeformat.FormatJSON))
+		sendSuccess(w, r, "Recipe unchanged", existingRecipe, http.StatusOK)
+		return
+	}
+
+	// Only the creator may change who can see the recipe
+	if !isOwner(existingRecipe, userID) {
+		for _, field := range changed {
+			for _, sharingField := range models.SharingFields {
+				if field == sharingField {
+					sendError(w, r, "Only the owner can change who can see a recipe", http.StatusForbidden)
+					return
+				}
+			}
+		}
+	}
+
+	// The patch was merged into the version we read, so that version must still be current
+	if err := rh.storage.UpdateRecipeFields(r.Context(), recipe, changed, userID); err != nil {
+		sendStorageError(w, r, err, "Failed to update recipe")
+		return
+	}
+
+	updated, err := rh.storage.GetRecipeByID(r.Context(), id, userID)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get updated recipe")
+		return
+	}
+
+	w.Header().Set("ETag", recipeETag(updated, recipeformat.FormatJSON))
+
+	sendSuccess(w, r, "Recipe updated successfully", updated, http.StatusOK)
 }
 
-// deleteRecipe handles DELETE /api/recipes/{id}
+// deleteRecipe handles DELETE /api/recipes/{id}. With If-Match the recipe
+// is only deleted if it still has that ETag.
 func (rh *RecipeHandler) deleteRecipe(w http.ResponseWriter, r *http.Request, id string) {
-	if err := rh.storage.DeleteRecipe(id); err != nil {
-		rh.sendError(w, fmt.Sprintf("Failed to delete recipe: %v", err), http.StatusNotFound)
+	userID := getUserIDFromRequest(r)
+
+	version := 0
+	if r.Header.Get("If-Match") != "" {
+		existingRecipe, err := rh.storage.GetRecipeByID(r.Context(), id, userID)
+		if err != nil {
+			sendStorageError(w, r, err, "Failed to get recipe")
+			return
+		}
+		if !rh.checkIfMatch(w, r, existingRecipe) {
+			return
+		}
+		version = existingRecipe.Version
+	}
+
+	if err := rh.storage.DeleteRecipe(r.Context(), id, version, userID); err != nil {
+		sendStorageError(w, r, err, "Failed to delete recipe")
+		return
+	}
+
+	sendSuccess(w, r, "Recipe deleted successfully", nil, http.StatusOK)
+}
+
+// notModified sets the ETag of a recipe representation and, if If-None-Match
+// lists it, sends 304 Not Modified and returns true
+func (rh *RecipeHandler) notModified(w http.ResponseWriter, r *http.Request, recipe *models.Recipe, format string) bool {
+	etag := recipeETag(recipe, format)
+	w.Header().Set("ETag", etag)
+
+	if !etagListed(r.Header.Get("If-None-Match"), etag, true) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// checkIfMatch checks an If-Match header, if any, against the current
+// recipe, sending 412 Precondition Failed and returning false if it fails
+func (rh *RecipeHandler) checkIfMatch(w http.ResponseWriter, r *http.Request, recipe *models.Recipe) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || etagListed(ifMatch, recipeETag(recipe, recipeformat.FormatJSON), false) {
+		return true
+	}
+
+	w.Header().Set("ETag", recipeETag(recipe, recipeformat.FormatJSON))
+	sendError(w, r, "Recipe has been modified; fetch it again and retry", http.StatusPreconditionFailed)
+	return false
+}
+
+// sendExport sends a recipe rendered in one of the recipeformat export formats
+func (rh *RecipeHandler) sendExport(w http.ResponseWriter, r *http.Request, recipe models.Recipe, format string) {
+	body, err := recipeformat.Export(recipe, format)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to export recipe", "error", err)
+		sendError(w, r, "Failed to export recipe", http.StatusInternalServerError)
 		return
 	}
 
-	response := models.APIResponse{
-		Success: true,
-		Message: "Recipe deleted successfully",
+	w.Header().Set("Content-Type", recipeformat.ContentTypes[format])
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// formatNames maps values of the format query parameter to export formats
+var formatNames = map[string]string{
+	"json":     recipeformat.FormatJSON,
+	"jsonld":   recipeformat.FormatJSONLD,
+	"json-ld":  recipeformat.FormatJSONLD,
+	"markdown": recipeformat.FormatMarkdown,
+	"md":       recipeformat.FormatMarkdown,
+	"text":     recipeformat.FormatText,
+	"txt":      recipeformat.FormatText,
+}
+
+// mediaTypeFormats maps Accept header media types to export formats
+var mediaTypeFormats = map[string]string{
+	"application/json":    recipeformat.FormatJSON,
+	"application/*":       recipeformat.FormatJSON,
+	"*/*":                 recipeformat.FormatJSON,
+	"application/ld+json": recipeformat.FormatJSONLD,
+	"text/markdown":       recipeformat.FormatMarkdown,
+	"text/x-markdown":     recipeformat.FormatMarkdown,
+	"text/plain":          recipeformat.FormatText,
+	"text/*":              recipeformat.FormatText,
+}
+
+// negotiateFormat picks the response format from the format query parameter,
+// falling back to the Accept header and then JSON. It returns false when the
+// client only accepts formats we cannot produce.
+func negotiateFormat(r *http.Request) (string, bool) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		format, ok := formatNames[strings.ToLower(name)]
+		return format, ok
 	}
 
-	rh.sendJSON(w, response, http.StatusOK)
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return recipeformat.FormatJSON, true
+	}
+
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		format, ok := mediaTypeFormats[mediaType]
+		if !ok {
+			continue
+		}
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+		if quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+
+	return best, best != ""
 }
 
-// sendJSON sends a JSON response
-func (rh *RecipeHandler) sendJSON(w http.ResponseWriter, data interface{}, statusCode int) {
-	w.WriteHeader(statusCode)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+// recipeETag returns the strong entity tag of a recipe in the given format,
+// derived from its version and a digest of the fields that change without a
+// version bump: the fork count, and the usernames and groups it is shared
+// with, as users can be renamed or deleted
+func recipeETag(recipe *models.Recipe, format string) string {
+	unversioned, _ := json.Marshal(struct {
+		ForkCount        int
+		SharedWithUsers  []string
+		SharedWithGroups []string
+	}{recipe.ForkCount, recipe.SharedWithUsers, recipe.SharedWithGroups})
+	sum := sha256.Sum256(unversioned)
+	digest := hex.EncodeToString(sum[:8])
+
+	if format == recipeformat.FormatJSON {
+		return fmt.Sprintf(`"%d-%s"`, recipe.Version, digest)
 	}
+	return fmt.Sprintf(`"%d-%s-%s"`, recipe.Version, digest, format)
 }
 
-// sendError sends an error response
-func (rh *RecipeHandler) sendError(w http.ResponseWriter, message string, statusCode int) {
-	response := models.APIError{
-		Success: false,
-		Error:   message,
+// etagListed reports whether an If-Match or If-None-Match header value lists
+// the entity tag or is "*". Weak tags (W/"...") only match when weak
+// comparison is allowed, as for If-None-Match.
+func etagListed(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
 	}
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(response)
+	return false
+}
+
+// isOwner reports whether the user created the recipe
+func isOwner(recipe *models.Recipe, userID *int) bool {
+	return recipe.CreatedBy != nil && userID != nil && *recipe.CreatedBy == *userID
 }
 
 // getUserIDFromRequest extracts user ID from request headers
-func (rh *RecipeHandler) getUserIDFromRequest(r *http.Request) *int {
+func getUserIDFromRequest(r *http.Request) *int {
 	userIDStr := r.Header.Get("X-User-ID")
 	if userIDStr == "" {
 		return nil
 	}
-	
+
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
 		return nil
 	}
-	
+
 	return &userID
 }
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"recipe-api/models"
+	"recipe-api/recipeformat"
+	"testing"
+)
+
+func TestRecipeETag(t *testing.T) {
+	base := models.Recipe{ID: "r1", Name: "Pancakes", Version: 3, SharedWithUsers: []string{"alice"}}
+	etag := recipeETag(&base, recipeformat.FormatJSON)
+
+	tests := []struct {
+		name        string
+		change      func(*models.Recipe)
+		format      string
+		wantChanged bool
+	}{
+		{name: "unchanged", change: func(*models.Recipe) {}, format: recipeformat.FormatJSON},
+		{name: "versioned field without a version bump", change: func(r *models.Recipe) { r.Name = "Crêpes" }, format: recipeformat.FormatJSON},
+		{name: "new version", change: func(r *models.Recipe) { r.Version++ }, format: recipeformat.FormatJSON, wantChanged: true},
+		{name: "forked", change: func(r *models.Recipe) { r.ForkCount++ }, format: recipeformat.FormatJSON, wantChanged: true},
+		{name: "shared user renamed", change: func(r *models.Recipe) { r.SharedWithUsers = []string{"alicia"} }, format: recipeformat.FormatJSON, wantChanged: true},
+		{name: "shared user deleted", change: func(r *models.Recipe) { r.SharedWithUsers = nil }, format: recipeformat.FormatJSON, wantChanged: true},
+		{name: "other format", change: func(*models.Recipe) {}, format: recipeformat.FormatMarkdown, wantChanged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipe := base
+			tt.change(&recipe)
+			got := recipeETag(&recipe, tt.format)
+			if changed := got != etag; changed != tt.wantChanged {
+				t.Errorf("recipeETag() = %s, base %s, changed = %v, want %v", got, etag, changed, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestETagListed(t *testing.T) {
+	tests := []struct {
+		header string
+		weak   bool
+		want   bool
+	}{
+		{header: `"3-abc"`, want: true},
+		{header: `"1-xyz", "3-abc"`, want: true},
+		{header: `*`, want: true},
+		{header: `"4-abc"`, want: false},
+		{header: `W/"3-abc"`, want: false},
+		{header: `W/"3-abc"`, weak: true, want: true},
+		{header: ``, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := etagListed(tt.header, `"3-abc"`, tt.weak); got != tt.want {
+				t.Errorf("etagListed(%q, weak %v) = %v, want %v", tt.header, tt.weak, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"recipe-api/models"
+)
+
+// Responder renders the responses of one version of the API: the envelope
+// around the result of a successful request, and the problem document for a
+// failed one. Handlers never build either themselves; they call sendSuccess
+// and the send*Error functions, which use the Responder of the API the
+// request arrived on. A version with a different envelope therefore needs a
+// new Responder, not a new set of handlers.
+type Responder interface {
+	// Success sends data, described by message, with statusCode
+	Success(w http.ResponseWriter, statusCode int, message string, data interface{})
+
+	// Problem sends problem, whose Status, Code, Detail and Errors are set
+	Problem(w http.ResponseWriter, problem models.Problem)
+}
+
+// V1Responder renders responses for /api/v1 and the legacy /api: results in
+// a models.APIResponse and errors as RFC 7807 problem details
+type V1Responder struct{}
+
+// Success sends data in a models.APIResponse
+func (V1Responder) Success(w http.ResponseWriter, statusCode int, message string, data interface{}) {
+	writeJSON(w, statusCode, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// Problem fills in the standard members of a problem and sends it. The
+// request ID is taken from the response header set by WithRequestID.
+func (V1Responder) Problem(w http.ResponseWriter, problem models.Problem) {
+	problem.Type = "about:blank"
+	problem.Title = http.StatusText(problem.Status)
+	if problem.Status == statusClientClosedRequest {
+		problem.Title = "Client Closed Request"
+	}
+	problem.RequestID = w.Header().Get(RequestIDHeader)
+	problem.Success = false
+	problem.Error = problem.Detail
+
+	w.Header().Set("Content-Type", models.ProblemContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// responderKey is the context key for the Responder of a request
+type responderKey struct{}
+
+// withResponder makes responder render the responses to the requests next
+// serves
+func withResponder(next http.Handler, responder Responder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), responderKey{}, responder)))
+	})
+}
+
+// responderFor returns the Responder of the API r arrived on, or
+// V1Responder for a request outside any API
+func responderFor(r *http.Request) Responder {
+	if responder, ok := r.Context().Value(responderKey{}).(Responder); ok {
+		return responder
+	}
+	return V1Responder{}
+}
+
+// sendSuccess sends the result of a successful request in the envelope of
+// the API it arrived on
+func sendSuccess(w http.ResponseWriter, r *http.Request, message string, data interface{}, statusCode int) {
+	responderFor(r).Success(w, statusCode, message, data)
+}
+
+// writeJSON sends body as JSON with statusCode
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"recipe-api/models"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// corsAllowHeaders lists the request headers browsers may send cross-origin
+const corsAllowHeaders = "Content-Type, Authorization, If-Match, If-None-Match, Idempotency-Key, X-Request-ID"
+
+// corsExposeHeaders lists the response headers browsers may read cross-origin
+const corsExposeHeaders = "ETag, Idempotent-Replayed, Deprecation, Sunset, Link, X-Request-ID"
+
+// Routes maps HTTP methods to the handlers for one path pattern
+type Routes map[string]http.HandlerFunc
+
+// API is a mount point for a version of the API, such as /api/v1. Handlers
+// register their routes relative to it, so the same registration can be
+// mounted under several prefixes. Each API renders its responses with its
+// own Responder, so a future version with a different response envelope
+// mounts the same handlers with another Responder.
+type API struct {
+	mux        *http.ServeMux
+	prefix     string
+	timeout    *atomic.Int64
+	responder  Responder
+	middleware func(http.Handler) http.Handler
+}
+
+// NewAPI creates an API whose routes are mounted under prefix on mux. Each
+// request's context is cancelled after timeout, which bounds the storage
+// calls made while serving it; 0 means no deadline. Responses are rendered
+// by V1Responder unless WithResponder picks another.
+func NewAPI(mux *http.ServeMux, prefix string, timeout time.Duration) *API {
+	api := &API{
+		mux:       mux,
+		prefix:    prefix,
+		timeout:   new(atomic.Int64),
+		responder: V1Responder{},
+	}
+	api.SetTimeout(timeout)
+	return api
+}
+
+// SetTimeout changes the request timeout for requests that arrive from now
+// on, including those to copies of the API made with Deprecated
+func (api *API) SetTimeout(timeout time.Duration) {
+	api.timeout.Store(int64(timeout))
+}
+
+// WithResponder returns a copy of the API whose responses are rendered by
+// responder
+func (api *API) WithResponder(responder Responder) *API {
+	copied := *api
+	copied.responder = responder
+	return &copied
+}
+
+// Deprecated returns a copy of the API whose responses carry Deprecation and
+// Sunset headers and a Link to the same path under successor
+func (api *API) Deprecated(sunset time.Time, successor string) *API {
+	prefix := api.prefix
+	return &API{
+		mux:       api.mux,
+		prefix:    prefix,
+		timeout:   api.timeout,
+		responder: api.responder,
+		middleware: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+				w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`,
+					successor, strings.TrimPrefix(r.URL.Path, prefix)))
+				next.ServeHTTP(w, r)
+			})
+		},
+	}
+}
+
+// Handle registers the routes for a Go 1.22 ServeMux path pattern such as
+// /recipes/{id}, relative to the API's prefix. Patterns are registered
+// without a method so that literal paths like /recipes/import take
+// precedence over wildcards for every method; dispatching on the method
+// happens in dispatchRoutes instead.
+func (api *API) Handle(pattern string, routes Routes) {
+	api.handle(pattern, withTimeout(dispatchRoutes(routes), api.timeout))
+}
+
+// HandleStreaming is Handle for routes that stream large bodies, such as
+// exports and backups, which are not given the request deadline or the
+// server's read and write timeouts
+func (api *API) HandleStreaming(pattern string, routes Routes) {
+	api.handle(pattern, withoutDeadlines(dispatchRoutes(routes)))
+}
+
+// HandleNotFound answers requests under the API's prefix that no route
+// matches with a 404 problem, rather than letting them fall through to the
+// static files served at /
+func (api *API) HandleNotFound() {
+	api.handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		sendErrorCode(w, r, models.CodeNotFound, "No API endpoint at "+r.URL.Path, http.StatusNotFound)
+	}))
+}
+
+func (api *API) handle(pattern string, handler http.Handler) {
+	handler = withResponder(handler, api.responder)
+	if api.middleware != nil {
+		handler = api.middleware(handler)
+	}
+	api.mux.Handle(api.prefix+pattern, Instrument(api.prefix+pattern, handler))
+}
+
+// withTimeout gives each request a context that is cancelled after the
+// current timeout, if there is one
+func withTimeout(next http.Handler, timeout *atomic.Int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := time.Duration(timeout.Load())
+		if d <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// withoutDeadlines clears the server's read and write deadlines for each
+// request
+func withoutDeadlines(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		controller := http.NewResponseController(w)
+		controller.SetReadDeadline(time.Time{})
+		controller.SetWriteDeadline(time.Time{})
+		next.ServeHTTP(w, r)
+	})
+}
+
+// dispatchRoutes returns a handler that calls the route for the request's
+// method. Every response gets CORS headers, OPTIONS answers preflight
+// requests, and other methods without a route get 405 with an Allow header.
+// GET routes also answer HEAD.
+func dispatchRoutes(routes Routes) http.HandlerFunc {
+	allowed := allowedMethods(routes)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", allowed)
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+		w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		w.Header().Set("Content-Type", "application/json")
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		method := r.Method
+		if method == "HEAD" && routes["HEAD"] == nil {
+			method = "GET"
+		}
+		handler, ok := routes[method]
+		if !ok {
+			w.Header().Set("Allow", allowed)
+			sendError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// allowedMethods returns the Allow header value for a set of routes
+func allowedMethods(routes Routes) string {
+	methods := []string{"OPTIONS"}
+	for method := range routes {
+		methods = append(methods, method)
+	}
+	if routes["GET"] != nil && routes["HEAD"] == nil {
+		methods = append(methods, "HEAD")
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// pathUUID returns the named path wildcard if it is a UUID
+func pathUUID(r *http.Request, name string) (string, bool) {
+	value := r.PathValue(name)
+	return value, isUUID(value)
+}
+
+// isUUID reports whether s is a UUID in the canonical 8-4-4-4-12 form
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	_, err := uuid.Parse(s)
+	return err == nil
+}
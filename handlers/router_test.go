@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"recipe-api/models"
+	"testing"
+	"time"
+)
+
+const testRecipeID = "6f1c2d3e-4a5b-4c6d-8e9f-0a1b2c3d4e5f"
+
+// testSunset is the Sunset of the deprecated API in testRouter
+var testSunset = time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+
+// testRouter returns a mux with recipe-like routes mounted under /api/v1 and
+// a deprecated /api alias, whose handlers record which of them ran in called
+func testRouter(called *string) *http.ServeMux {
+	rh := &RecipeHandler{}
+	route := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			*called = name
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+	withID := func(name string) http.HandlerFunc {
+		return rh.withRecipeID(func(w http.ResponseWriter, r *http.Request, id string) {
+			*called = name + " " + id
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+
+	mux := http.NewServeMux()
+	v1 := NewAPI(mux, "/api/v1", 0)
+	legacy := NewAPI(mux, "/api", 0).Deprecated(testSunset, "/api/v1")
+	for _, api := range []*API{v1, legacy} {
+		api.Handle("/recipes", Routes{"GET": route("list"), "POST": route("create")})
+		api.Handle("/recipes/{id}", Routes{"GET": withID("get"), "DELETE": withID("delete")})
+		api.Handle("/recipes/import", Routes{"POST": route("import")})
+		api.HandleNotFound()
+	}
+	return mux
+}
+
+func TestDispatchRoutes(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantCalled string
+		wantAllow  string
+	}{
+		{name: "route for the method", method: "GET", path: "/api/v1/recipes", wantStatus: http.StatusOK, wantCalled: "list"},
+		{name: "HEAD falls back to GET", method: "HEAD", path: "/api/v1/recipes", wantStatus: http.StatusOK, wantCalled: "list"},
+		{name: "wildcard with a UUID", method: "DELETE", path: "/api/v1/recipes/" + testRecipeID, wantStatus: http.StatusOK, wantCalled: "delete " + testRecipeID},
+		{name: "wildcard that is not a UUID", method: "GET", path: "/api/v1/recipes/42", wantStatus: http.StatusBadRequest},
+		{name: "literal path takes precedence", method: "POST", path: "/api/v1/recipes/import", wantStatus: http.StatusOK, wantCalled: "import"},
+		{
+			name: "method without a route", method: "PUT", path: "/api/v1/recipes/" + testRecipeID,
+			wantStatus: http.StatusMethodNotAllowed, wantAllow: "DELETE, GET, HEAD, OPTIONS",
+		},
+		{
+			name: "method without a route on a literal path", method: "GET", path: "/api/v1/recipes/import",
+			wantStatus: http.StatusMethodNotAllowed, wantAllow: "OPTIONS, POST",
+		},
+		{name: "preflight", method: "OPTIONS", path: "/api/v1/recipes", wantStatus: http.StatusOK},
+		{name: "unknown API path", method: "GET", path: "/api/v1/recipe", wantStatus: http.StatusNotFound},
+		{name: "unknown legacy API path", method: "POST", path: "/api/nothing/here", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := ""
+			w := httptest.NewRecorder()
+			testRouter(&called).ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if called != tt.wantCalled {
+				t.Errorf("handler called = %q, want %q", called, tt.wantCalled)
+			}
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+				t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+			}
+			if got := w.Header().Get("Content-Type"); w.Code >= 400 && got != models.ProblemContentType {
+				t.Errorf("Content-Type = %q, want %q", got, models.ProblemContentType)
+			}
+		})
+	}
+}
+
+func TestDispatchRoutesPreflight(t *testing.T) {
+	called := ""
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("OPTIONS", "/api/v1/recipes/"+testRecipeID, nil)
+	r.Header.Set("Access-Control-Request-Method", "DELETE")
+	testRouter(&called).ServeHTTP(w, r)
+
+	want := map[string]string{
+		"Access-Control-Allow-Methods":  "DELETE, GET, HEAD, OPTIONS",
+		"Access-Control-Allow-Headers":  corsAllowHeaders,
+		"Access-Control-Expose-Headers": corsExposeHeaders,
+	}
+	for header, value := range want {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+	if called != "" {
+		t.Errorf("preflight ran the %q handler", called)
+	}
+}
+
+func TestDeprecatedAPI(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		wantCalled     string
+		wantDeprecated bool
+		wantLink       string
+	}{
+		{name: "versioned path", path: "/api/v1/recipes/" + testRecipeID, wantCalled: "get " + testRecipeID},
+		{
+			name: "legacy alias", path: "/api/recipes/" + testRecipeID, wantCalled: "get " + testRecipeID,
+			wantDeprecated: true, wantLink: `</api/v1/recipes/` + testRecipeID + `>; rel="successor-version"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := ""
+			w := httptest.NewRecorder()
+			testRouter(&called).ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			if called != tt.wantCalled {
+				t.Errorf("handler called = %q, want %q", called, tt.wantCalled)
+			}
+			if deprecated := w.Header().Get("Deprecation") == "true"; deprecated != tt.wantDeprecated {
+				t.Errorf("Deprecation = %v, want %v", deprecated, tt.wantDeprecated)
+			}
+			if got := w.Header().Get("Link"); got != tt.wantLink {
+				t.Errorf("Link = %q, want %q", got, tt.wantLink)
+			}
+			wantSunset := ""
+			if tt.wantDeprecated {
+				wantSunset = testSunset.Format(http.TimeFormat)
+			}
+			if got := w.Header().Get("Sunset"); got != wantSunset {
+				t.Errorf("Sunset = %q, want %q", got, wantSunset)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"recipe-api/auth"
+	"recipe-api/models"
+	"recipe-api/storage"
+	"time"
+)
+
+// defaultShareLinkExpiryHours is used when a share link request does not set an expiry
+const defaultShareLinkExpiryHours = 7 * 24
+
+// sharedRecipePath is the path share link URLs are built from
+const sharedRecipePath = "/api/v1/shared/"
+
+// ShareLinkHandler handles HTTP requests for recipe share links
+type ShareLinkHandler struct {
+	recipeStorage    storage.RecipeStorage
+	shareLinkStorage storage.ShareLinkStorage
+	authService      *auth.AuthService
+}
+
+// NewShareLinkHandler creates a new share link handler
+func NewShareLinkHandler(recipeStorage storage.RecipeStorage, shareLinkStorage storage.ShareLinkStorage, authService *auth.AuthService) *ShareLinkHandler {
+	return &ShareLinkHandler{
+		recipeStorage:    recipeStorage,
+		shareLinkStorage: shareLinkStorage,
+		authService:      authService,
+	}
+}
+
+// RegisterRoutes registers the share link routes on api. protect wraps the
+// routes that require an authenticated user.
+func (sh *ShareLinkHandler) RegisterRoutes(api *API, protect func(http.HandlerFunc) http.HandlerFunc) {
+	api.Handle("/recipes/{id}/share-links", Routes{
+		"GET":  protect(sh.ownerOnly(sh.getShareLinks)),
+		"POST": protect(sh.ownerOnly(sh.createShareLink)),
+	})
+	api.Handle("/recipes/{id}/share-links/{linkID}", Routes{
+		"DELETE": protect(sh.ownerOnly(sh.revokeShareLink)),
+	})
+
+	// Public routes (no login required)
+	api.Handle("/shared/{token}", Routes{"GET": sh.getSharedRecipe})
+}
+
+// ownerOnly adapts a handler for the share links of the recipe in the {id}
+// path wildcard. Only the recipe's creator may manage its share links.
+func (sh *ShareLinkHandler) ownerOnly(next func(w http.ResponseWriter, r *http.Request, recipeID string, userID *int)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recipeID, ok := pathUUID(r, "id")
+		if !ok {
+			sendErrorCode(w, r, models.CodeInvalidID, "Invalid recipe ID", http.StatusBadRequest)
+			return
+		}
+
+		userID := getUserIDFromRequest(r)
+		recipe, err := sh.recipeStorage.GetRecipeByID(r.Context(), recipeID, userID)
+		if err != nil {
+			sendStorageError(w, r, err, "Failed to get recipe")
+			return
+		}
+		if !isOwner(recipe, userID) {
+			sendError(w, r, "Only the recipe owner can manage share links", http.StatusForbidden)
+			return
+		}
+
+		next(w, r, recipeID, userID)
+	}
+}
+
+// getSharedRecipe handles unauthenticated GET /api/shared/{token}
+func (sh *ShareLinkHandler) getSharedRecipe(w http.ResponseWriter, r *http.Request) {
+	linkID, err := sh.authService.VerifyShareToken(r.PathValue("token"))
+	if err != nil {
+		sendError(w, r, "Invalid or expired share link", http.StatusNotFound)
+		return
+	}
+
+	recipe, err := sh.shareLinkStorage.GetRecipeByShareLink(r.Context(), linkID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			sendError(w, r, "Invalid or expired share link", http.StatusNotFound)
+			return
+		}
+		sendStorageError(w, r, err, "Failed to get shared recipe")
+		return
+	}
+
+	sendSuccess(w, r, "Recipe retrieved successfully", recipe.PublicView(), http.StatusOK)
+}
+
+// getShareLinks handles GET /api/recipes/{id}/share-links
+func (sh *ShareLinkHandler) getShareLinks(w http.ResponseWriter, r *http.Request, recipeID string, userID *int) {
+	links, err := sh.shareLinkStorage.GetShareLinks(r.Context(), recipeID)
+	if err != nil {
+		sendStorageError(w, r, err, "Failed to get share links")
+		return
+	}
+
+	for i := range links {
+		sh.setToken(&links[i])
+	}
+
+	sendSuccess(w, r, "Share links retrieved successfully", links, http.StatusOK)
+}
+
+// createShareLink handles POST /api/recipes/{id}/share-links
+func (sh *ShareLinkHandler) createShareLink(w http.ResponseWriter, r *http.Request, recipeID string, userID *int) {
+	var req models.ShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		sendErrorCode(w, r, models.CodeInvalidJSON, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.ExpiresInHours < 0 {
+		sendError(w, r, "Validation error: expires_in_hours must be positive", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = defaultShareLinkExpiryHours
+	}
+
+	link := models.ShareLink{
+		RecipeID:  recipeID,
+		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour).Truncate(time.Second),
+		CreatedBy: userID,
+	}
+
+	if err := sh.shareLinkStorage.CreateShareLink(r.Context(), &link); err != nil {
+		sendStorageError(w, r, err, "Failed to create share link")
+		return
+	}
+	sh.setToken(&link)
+
+	sendSuccess(w, r, "Share link created successfully", link, http.StatusCreated)
+}
+
+// revokeShareLink handles DELETE /api/recipes/{id}/share-links/{linkID}
+func (sh *ShareLinkHandler) revokeShareLink(w http.ResponseWriter, r *http.Request, recipeID string, userID *int) {
+	linkID, ok := pathUUID(r, "linkID")
+	if !ok {
+		sendErrorCode(w, r, models.CodeInvalidID, "Invalid share link ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := sh.shareLinkStorage.RevokeShareLink(r.Context(), linkID, recipeID); err != nil {
+		sendStorageError(w, r, err, "Failed to revoke share link")
+		return
+	}
+
+	sendSuccess(w, r, "Share link revoked successfully", nil, http.StatusOK)
+}
+
+// setToken fills in the signed token and URL for a share link
+func (sh *ShareLinkHandler) setToken(link *models.ShareLink) {
+	link.Token = sh.authService.SignShareToken(link.ID, link.ExpiresAt)
+	link.URL = sharedRecipePath + link.Token
+}
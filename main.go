@@ -1,19 +1,32 @@
 package main
 
 import (
-	"io/ioutil"
-	"log"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"recipe-api/auth"
+	"recipe-api/config"
 	"recipe-api/database"
 	_ "recipe-api/docs"
 	"recipe-api/handlers"
+	"recipe-api/logging"
+	"recipe-api/metrics"
 	"recipe-api/models"
 	"recipe-api/storage"
+	"recipe-api/tracing"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	httpSwagger "github.com/swaggo/http-swagger"
-	"gopkg.in/yaml.v2"
 )
 
 // @title Recipe API
@@ -26,101 +39,455 @@ import (
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
 
-func main() {
-	// Load configuration
-	config, err := loadConfig("config.yaml")
-	if err != nil {
-		log.Fatal("Failed to load config:", err)
-	}
+// version is the build version, set with -ldflags "-X main.version=..."
+var version = "dev"
 
-	// Initialize database connection
-	if err := database.InitDB(config.Database); err != nil {
-		log.Fatal("Failed to initialize database:", err)
-	}
-	defer database.CloseDB()
+// backgroundJobs is the number of routines StartBackgroundJobs starts
+const backgroundJobs = 2
 
-	// Run database migrations
-	if err := database.RunMigrations(""); err != nil {
-		log.Printf("Warning: Failed to run migrations: %v", err)
-	}
+// legacyAPISunset is when the unversioned /api alias of /api/v1 goes away
+var legacyAPISunset = time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+
+// tracingShutdownTimeout bounds how long shutdown waits for the remaining
+// spans to be exported
+const tracingShutdownTimeout = 5 * time.Second
+
+// logLevel is the level of the default logger, set from log_level
+var logLevel slog.LevelVar
+
+// App holds everything the server is wired from: the configuration, the
+// database handle, and the storage, services and handlers built on them
+type App struct {
+	config   *models.Config
+	configMu sync.Mutex
+	db       *sql.DB
+	apis     []*handlers.API
+	workers  sync.WaitGroup
+	requests sync.WaitGroup
+	running  atomic.Int32
+
+	// cancelRequests cancels the contexts of the requests served by Server
+	cancelRequests context.CancelFunc
+
+	recipeStorage      *storage.PostgresStorage
+	userStorage        *storage.PostgresUserStorage
+	pantryStorage      *storage.PostgresPantryStorage
+	shareLinkStorage   *storage.PostgresShareLinkStorage
+	backupStorage      *storage.PostgresBackupStorage
+	duplicateStorage   *storage.PostgresDuplicateStorage
+	idempotencyStorage *storage.PostgresIdempotencyStorage
+
+	authService *auth.AuthService
+
+	recipeHandler     *handlers.RecipeHandler
+	pantryHandler     *handlers.PantryHandler
+	shareLinkHandler  *handlers.ShareLinkHandler
+	authHandler       *handlers.AuthHandler
+	adminHandler      *handlers.AdminHandler
+	healthHandler     *handlers.HealthHandler
+	publicPageHandler *handlers.PublicPageHandler
+}
+
+// NewApp builds the storage, services and handlers for config on db. The
+// caller keeps ownership of db.
+func NewApp(config *models.Config, db *sql.DB) (*App, error) {
+	app := &App{config: config, db: db}
 
 	// Initialize storage
-	recipeStorage := storage.NewPostgresStorage()
-	userStorage := storage.NewPostgresUserStorage()
+	queryTimeout := database.QueryTimeout(config.Database)
+	app.recipeStorage = storage.NewPostgresStorage(db, queryTimeout)
+	app.userStorage = storage.NewPostgresUserStorage(db, queryTimeout)
+	app.pantryStorage = storage.NewPostgresPantryStorage(db, queryTimeout)
+	app.shareLinkStorage = storage.NewPostgresShareLinkStorage(db, queryTimeout)
+	app.backupStorage = storage.NewPostgresBackupStorage(db)
+	app.duplicateStorage = storage.NewPostgresDuplicateStorage(db, queryTimeout)
+	app.idempotencyStorage = storage.NewPostgresIdempotencyStorage(db, queryTimeout,
+		time.Duration(config.IdempotencyKeyTTLHours)*time.Hour, config.RequestTimeout())
 
 	// Initialize authentication service
-	authService, err := auth.NewAuthService("config.yaml", userStorage)
-	if err != nil {
-		log.Fatal("Failed to initialize auth service:", err)
+	app.authService = auth.NewAuthService(config, app.userStorage)
+
+	// Report the connection pool and logged in sessions on /metrics
+	if err := metrics.RegisterDatabase(db, config.Database.DBName); err != nil {
+		return nil, fmt.Errorf("failed to register database metrics: %v", err)
+	}
+	if err := metrics.RegisterActiveSessions(app.authService.GetActiveTokensCount); err != nil {
+		return nil, fmt.Errorf("failed to register session metrics: %v", err)
 	}
 
 	// Initialize handlers
-	recipeHandler := handlers.NewRecipeHandler(recipeStorage)
-	authHandler := handlers.NewAuthHandler(authService)
+	app.recipeHandler = handlers.NewRecipeHandler(app.recipeStorage, app.pantryStorage, app.duplicateStorage, app.idempotencyStorage)
+	app.pantryHandler = handlers.NewPantryHandler(app.pantryStorage)
+	app.shareLinkHandler = handlers.NewShareLinkHandler(app.recipeStorage, app.shareLinkStorage, app.authService)
+	app.authHandler = handlers.NewAuthHandler(app.authService)
+	schemaVersion := func(ctx context.Context) (uint, error) {
+		return database.MigrationVersion(ctx, db)
+	}
+	expectedSchemaVersion, err := database.LatestMigrationVersion()
+	if err != nil {
+		return nil, err
+	}
+	app.adminHandler = handlers.NewAdminHandler(app.backupStorage, app.authService, schemaVersion)
+	app.healthHandler = handlers.NewHealthHandler(db, app.authService, schemaVersion,
+		expectedSchemaVersion, app.WorkersRunning, version)
+	app.publicPageHandler, err = handlers.NewPublicPageHandler(app.recipeStorage, "templates/recipe.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize public pages: %v", err)
+	}
+
+	return app, nil
+}
+
+// Routes returns the server's mux with every route registered
+func (app *App) Routes() *http.ServeMux {
+	// Setup routes on a Go 1.22 pattern mux. Every handler registers its
+	// routes under /api/v1, and again under /api as a deprecated alias.
+	mux := http.NewServeMux()
+	requestTimeout := app.config.RequestTimeout()
+	v1 := handlers.NewAPI(mux, "/api/v1", requestTimeout)
+	legacy := handlers.NewAPI(mux, "/api", requestTimeout).Deprecated(legacyAPISunset, "/api/v1")
+	app.apis = []*handlers.API{v1, legacy}
+	for _, api := range app.apis {
+		app.authHandler.RegisterRoutes(api)
+		app.recipeHandler.RegisterRoutes(api, app.authHandler.AuthMiddleware)
+		app.shareLinkHandler.RegisterRoutes(api, app.authHandler.AuthMiddleware)
+		app.pantryHandler.RegisterRoutes(api, app.authHandler.AuthMiddleware)
+		app.adminHandler.RegisterRoutes(api, app.authHandler.AdminMiddleware)
+		app.healthHandler.RegisterRoutes(api, app.authHandler.AdminMiddleware)
+		api.HandleNotFound()
+	}
+
+	// Liveness and readiness probes
+	app.healthHandler.RegisterProbes(mux)
 
-	// Setup authentication routes (public)
-	http.HandleFunc("/api/login", authHandler.HandleLogin)
-	http.HandleFunc("/api/logout", authHandler.HandleLogout)
+	// Prometheus metrics
+	mux.Handle("GET /metrics", metrics.Handler())
 
-	// Setup protected routes (require authentication)
-	http.HandleFunc("/api/recipes", authHandler.AuthMiddleware(recipeHandler.HandleRecipes))
-	http.HandleFunc("/api/recipes/", authHandler.AuthMiddleware(recipeHandler.HandleRecipeByID))
+	// Server-rendered pages for public recipes
+	mux.Handle("GET /recipes/{id}", handlers.Instrument("/recipes/{id}", http.HandlerFunc(app.publicPageHandler.HandleRecipePage)))
 
 	// Setup Swagger documentation
-	http.HandleFunc("/swagger/", httpSwagger.WrapHandler)
+	mux.HandleFunc("/swagger/", httpSwagger.WrapHandler)
 
 	// Serve static files (HTML, CSS, JS)
-	http.Handle("/", http.FileServer(http.Dir("static/")))
+	mux.Handle("/", http.FileServer(http.Dir("static/")))
 
-	// Start token cleanup routine
+	return mux
+}
+
+// restartSettings are the configuration keys, or key prefixes, that only take
+// effect when the server is restarted
+var restartSettings = []string{
+	"listen_addr", "dev_mode", "database.",
+	"read_timeout_seconds", "write_timeout_seconds", "idle_timeout_seconds", "shutdown_timeout_seconds",
+	"tracing.",
+}
+
+// Reload re-reads the configuration from configPath, applies the settings
+// that can change while the server runs and logs what changed. An invalid
+// configuration is rejected and the running one kept.
+func (app *App) Reload(configPath string) error {
+	next, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	app.configMu.Lock()
+	defer app.configMu.Unlock()
+
+	// The new settings must also hold together with the restart-only
+	// settings the server keeps running with
+	applied := reloadable(*app.config, *next)
+	if err := config.Validate(&applied); err != nil {
+		return fmt.Errorf("configuration is only valid after a restart: %v", err)
+	}
+
+	changes := config.Diff(*app.config, *next)
+	if len(changes) == 0 {
+		slog.Info("Configuration reloaded: nothing changed")
+		return nil
+	}
+
+	for _, change := range changes {
+		slog.Info("Configuration reloaded", "setting", change.Key, "old", change.Old, "new", change.New,
+			"requires_restart", requiresRestart(change.Key))
+	}
+
+	level, _ := config.ParseLogLevel(applied.LogLevel)
+	logLevel.Set(level)
+	app.authService.Reload(&applied)
+	app.idempotencyStorage.SetWindow(time.Duration(applied.IdempotencyKeyTTLHours) * time.Hour)
+	app.idempotencyStorage.SetPendingTimeout(applied.RequestTimeout())
+	for _, api := range app.apis {
+		api.SetTimeout(applied.RequestTimeout())
+	}
+	app.config = &applied
+	return nil
+}
+
+// reloadable returns the running configuration with the settings that take
+// effect without a restart taken from next. The restartSettings keep their
+// running values, so the configuration always describes the server as it
+// runs.
+func reloadable(running, next models.Config) models.Config {
+	running.LogLevel = next.LogLevel
+	running.JWTSecret = next.JWTSecret
+	running.SecretGraceHours = next.SecretGraceHours
+	running.TokenExpiryHours = next.TokenExpiryHours
+	running.IdempotencyKeyTTLHours = next.IdempotencyKeyTTLHours
+	running.RequestTimeoutSeconds = next.RequestTimeoutSeconds
+	return running
+}
+
+// requiresRestart reports whether a configuration key is one of restartSettings
+func requiresRestart(key string) bool {
+	for _, setting := range restartSettings {
+		if key == setting || (strings.HasSuffix(setting, ".") && strings.HasPrefix(key, setting)) {
+			return true
+		}
+	}
+	return false
+}
+
+// StartBackgroundJobs starts the token and idempotency key cleanup and
+// duplicate detection routines. They run until ctx is cancelled; Wait
+// blocks until they have stopped.
+func (app *App) StartBackgroundJobs(ctx context.Context) {
+	// Start token and idempotency key cleanup routine
+	app.workers.Add(1)
+	app.running.Add(1)
 	go func() {
+		defer app.workers.Done()
+		defer app.running.Add(-1)
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
 		for {
 			select {
+			case <-ctx.Done():
+				return
 			case <-ticker.C:
-				authService.CleanupExpiredTokens()
-				log.Printf("Cleaned up expired tokens. Active tokens: %d", authService.GetActiveTokensCount())
+				app.authService.CleanupExpiredTokens()
+				slog.Info("Cleaned up expired tokens", "active_tokens", app.authService.GetActiveTokensCount())
+				if removed, err := app.idempotencyStorage.DeleteExpiredIdempotencyKeys(ctx); err != nil {
+					slog.Error("Failed to clean up idempotency keys", "error", err)
+				} else {
+					slog.Info("Cleaned up expired idempotency keys", "removed", removed)
+				}
 			}
 		}
 	}()
 
-	// Start server
-	log.Println("Server starting on :8080")
-	log.Println("Authentication endpoints:")
-	log.Println("  POST /api/login - Login with username/password")
-	log.Println("  POST /api/logout - Logout (invalidate token)")
-	log.Println("Protected API endpoints:")
-	log.Println("  GET/POST/PUT /api/recipes - Recipe operations (requires Bearer token)")
-	log.Println("  DELETE /api/recipes/{id} - Delete recipe (requires Bearer token)")
-	log.Println("API Documentation:")
-	log.Println("  Swagger UI: http://localhost:8080/swagger/")
-	log.Println("Web interface at: http://localhost:8080")
-	
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatal("Server failed to start:", err)
-	}
-}
-
-// loadConfig loads configuration from YAML file
-func loadConfig(configPath string) (*models.Config, error) {
-	data, err := ioutil.ReadFile(configPath)
+	// Start duplicate detection routine
+	app.workers.Add(1)
+	app.running.Add(1)
+	go func() {
+		defer app.workers.Done()
+		defer app.running.Add(-1)
+		detectDuplicates(ctx, app.duplicateStorage)
+		ticker := time.NewTicker(6 * time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				detectDuplicates(ctx, app.duplicateStorage)
+			}
+		}
+	}()
+}
+
+// WorkersRunning reports whether all of the background jobs are running
+func (app *App) WorkersRunning() bool {
+	return app.running.Load() == backgroundJobs
+}
+
+// Wait blocks until the background jobs have stopped and the requests
+// served by Server have returned
+func (app *App) Wait() {
+	app.workers.Wait()
+	app.requests.Wait()
+}
+
+// Server returns an HTTP server for handler configured with the server
+// timeouts. Every request is given a request ID, and the server's own errors
+// are logged as warnings. Request contexts derive from a base context that
+// Shutdown cancels once the drain period is over.
+func (app *App) Server(handler http.Handler) *http.Server {
+	base, cancel := context.WithCancel(context.Background())
+	app.cancelRequests = cancel
+	return &http.Server{
+		Addr:              app.config.ListenAddr,
+		Handler:           app.trackRequests(handlers.WithRequestID(handler)),
+		BaseContext:       func(net.Listener) context.Context { return base },
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		ReadHeaderTimeout: time.Duration(app.config.ReadTimeoutSeconds) * time.Second,
+		ReadTimeout:       time.Duration(app.config.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:      time.Duration(app.config.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:       time.Duration(app.config.IdleTimeoutSeconds) * time.Second,
+	}
+}
+
+// trackRequests counts the requests in flight, so that Wait can wait for
+// handlers that outlive their connection
+func (app *App) trackRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.requests.Add(1)
+		defer app.requests.Done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Shutdown stops server from accepting requests and gives those in flight
+// up to drain to finish. Requests still running after that have their
+// contexts cancelled and their connections closed; Wait waits for their
+// handlers to return.
+func (app *App) Shutdown(server *http.Server, drain time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("Drain period ended with requests still running", "error", err)
+		app.cancelRequests()
+		server.Close()
+	}
+}
+
+func main() {
+	configPath := flag.String("config", config.DefaultPath, "path to the YAML configuration file")
+	flag.Parse()
+
+	// Log JSON lines to stderr, including the standard library's log output
+	slog.SetDefault(logging.New(os.Stderr, &logLevel))
+
+	// Run CLI subcommands (backup, restore, config) instead of the server when given
+	if flag.NArg() > 0 {
+		if err := runCommand(*configPath, flag.Arg(0), flag.Args()[1:]); err != nil {
+			fatal("Command failed", err)
+		}
+		return
+	}
+
+	// Load configuration
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		return nil, err
+		fatal("Failed to load config", err)
+	}
+	level, _ := config.ParseLogLevel(cfg.LogLevel)
+	logLevel.Set(level)
+	if cfg.DevMode {
+		slog.Warn("Running in dev mode; insecure settings are allowed")
 	}
 
-	var config models.Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, err
+	// Export traces as configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, version)
+	if err != nil {
+		fatal("Failed to initialize tracing", err)
 	}
 
-	// Set default values if not specified
-	if config.TokenExpiryHours == 0 {
-		config.TokenExpiryHours = 24
+	// Initialize database connection
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		fatal("Failed to initialize database", err)
 	}
-	if config.JWTSecret == "" {
-		config.JWTSecret = "default-secret-change-this"
+
+	// Run database migrations
+	if err := database.RunMigrations(db); err != nil {
+		slog.Warn("Failed to run migrations", "error", err)
+	}
+
+	app, err := NewApp(cfg, db)
+	if err != nil {
+		fatal("Failed to initialize server", err)
+	}
+
+	// Key pantry items saved before ingredient_key existed, before new
+	// items can be saved alongside them
+	if merged, err := app.pantryStorage.KeyLegacyItems(context.Background()); err != nil {
+		slog.Warn("Failed to key pantry items", "error", err)
+	} else if merged > 0 {
+		slog.Info("Merged pantry items of the same ingredient", "merged", merged)
+	}
+	server := app.Server(app.Routes())
+
+	// Stop on SIGINT or SIGTERM. A second signal exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobs, stopJobs := context.WithCancel(context.Background())
+	app.StartBackgroundJobs(jobs)
+
+	// Reload the configuration on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+	go func() {
+		for range reload {
+			if err := app.Reload(*configPath); err != nil {
+				slog.Error("Configuration reload failed, keeping the running configuration", "error", err)
+			}
+		}
+	}()
+
+	// Start server. The routes are listed in the README and the Swagger UI
+	// at /swagger/.
+	slog.Info("Server starting", "addr", cfg.ListenAddr, "version", version)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	var serveErr error
+	select {
+	case serveErr = <-serverErr:
+	case <-ctx.Done():
+		stop()
+		drain := time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second
+		slog.Info("Shutting down; waiting for in-flight requests", "drain", drain.String())
+
+		app.Shutdown(server, drain)
+	}
+
+	// Stop the background jobs and wait for them and any request handlers
+	// still running, then close the pool now that nothing uses it
+	stopJobs()
+	app.Wait()
+	if err := db.Close(); err != nil {
+		slog.Error("Failed to close database", "error", err)
+	}
+
+	// Send the spans still waiting to be exported
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancelTracing()
+	if err := shutdownTracing(tracingCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+	if serveErr != nil {
+		fatal("Server failed", serveErr)
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs err with msg and exits with status 1
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// detectDuplicates scores every pair of recipes and replaces the stored
+// duplicate candidates with the pairs that look like duplicates
+func detectDuplicates(ctx context.Context, duplicateStorage storage.DuplicateStorage) {
+	recipes, err := duplicateStorage.GetRecipesForScan(ctx)
+	if err != nil {
+		slog.Error("Duplicate detection failed", "error", err)
+		return
+	}
+
+	candidates := models.FindDuplicates(recipes, models.DuplicateScoreThreshold, time.Now())
+	if err := duplicateStorage.ReplaceDuplicateCandidates(ctx, candidates); err != nil {
+		slog.Error("Duplicate detection failed", "error", err)
+		return
 	}
 
-	return &config, nil
+	slog.Info("Duplicate detection finished", "candidates", len(candidates), "recipes", len(recipes))
 }
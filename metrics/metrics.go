@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the name of every metric the server defines
+const namespace = "recipe_api"
+
+// Login results counted by ObserveLogin
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+// registry holds the server's metrics along with the Go runtime and process
+// collectors. It is used instead of the default registry so that /metrics
+// shows only what is registered here.
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route pattern, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests, by route pattern, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by storage operations, by operation.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"operation"})
+
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts, by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpRequestDuration,
+		dbQueryDuration,
+		logins,
+	)
+
+	// Start every login result at zero so rates work before the first failure
+	logins.WithLabelValues(LoginSuccess)
+	logins.WithLabelValues(LoginFailure)
+}
+
+// Handler serves the registered metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDatabase adds gauges and counters for the connection pool of db,
+// labelled with dbName
+func RegisterDatabase(db *sql.DB, dbName string) error {
+	return registry.Register(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// RegisterActiveSessions adds a gauge reporting the number of logged in
+// sessions, read from activeSessions whenever metrics are collected
+func RegisterActiveSessions(activeSessions func() int) error {
+	return registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_sessions",
+		Help:      "Sessions with an unexpired login token.",
+	}, func() float64 {
+		return float64(activeSessions())
+	}))
+}
+
+// ObserveRequest records an HTTP request served for route, the pattern it
+// was registered under
+func ObserveRequest(route, method string, statusCode int, duration time.Duration) {
+	status := strconv.Itoa(statusCode)
+	httpRequests.WithLabelValues(route, method, status).Inc()
+	httpRequestDuration.WithLabelValues(route, method, status).Observe(duration.Seconds())
+}
+
+// ObserveQuery records the time since start taken by a storage operation.
+// Storage operations call it when they end, through the operation started
+// by startOperation in the storage package, once per exported call.
+func ObserveQuery(operation string, start time.Time) {
+	dbQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// ObserveLogin counts a login attempt with result LoginSuccess or LoginFailure
+func ObserveLogin(result string) {
+	logins.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_pantry_items_updated_at ON pantry_items;
+DROP TABLE IF EXISTS pantry_items;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS pantry_items (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ingredient VARCHAR(255) NOT NULL,
+    quantity VARCHAR(100) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, ingredient)
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_pantry_items_user_id ON pantry_items(user_id);
+CREATE INDEX IF NOT EXISTS idx_pantry_items_expires_at ON pantry_items(expires_at);
+
+-- Create trigger to update updated_at column
+CREATE TRIGGER update_pantry_items_updated_at 
+    BEFORE UPDATE ON pantry_items 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_recipes_shared_with_groups;
+DROP INDEX IF EXISTS idx_recipes_shared_with_users;
+DROP INDEX IF EXISTS idx_recipes_visibility;
+ALTER TABLE recipes DROP COLUMN IF EXISTS shared_with_groups;
+ALTER TABLE recipes DROP COLUMN IF EXISTS shared_with_users;
+ALTER TABLE recipes DROP COLUMN IF EXISTS visibility;
+ALTER TABLE users DROP COLUMN IF EXISTS groups;
@@ -0,0 +1,16 @@
+-- Groups a user belongs to, used when sharing recipes with groups
+ALTER TABLE users ADD COLUMN IF NOT EXISTS groups TEXT[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'private'
+    CHECK (visibility IN ('private', 'shared', 'public'));
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS shared_with_users INTEGER[] NOT NULL DEFAULT '{}';
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS shared_with_groups TEXT[] NOT NULL DEFAULT '{}';
+
+-- Existing recipes take the 'private' default rather than 'public': before
+-- this migration only logged in users could read them, and 'public' would
+-- also show them to anonymous callers. Owners can share them again.
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_recipes_visibility ON recipes(visibility);
+CREATE INDEX IF NOT EXISTS idx_recipes_shared_with_users ON recipes USING GIN (shared_with_users);
+CREATE INDEX IF NOT EXISTS idx_recipes_shared_with_groups ON recipes USING GIN (shared_with_groups);
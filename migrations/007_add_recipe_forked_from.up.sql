@@ -0,0 +1,5 @@
+-- Recipe this one was copied from, cleared if the original is deleted
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS forked_from UUID REFERENCES recipes(id) ON DELETE SET NULL;
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_recipes_forked_from ON recipes(forked_from);
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT false;
+
+-- The default admin account gets administrator rights
+UPDATE users SET is_admin = true WHERE username = 'admin';
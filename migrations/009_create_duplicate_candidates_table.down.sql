@@ -0,0 +1 @@
+DROP TABLE IF EXISTS duplicate_candidates;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS duplicate_candidates (
+    recipe_id UUID NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+    duplicate_id UUID NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    detected_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (recipe_id, duplicate_id)
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_duplicate_candidates_duplicate_id ON duplicate_candidates(duplicate_id);
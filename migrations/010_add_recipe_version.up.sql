@@ -0,0 +1,2 @@
+-- Incremented on every change, used for ETags and optimistic concurrency
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+-- Content-Type of the stored response, sent again when it is replayed
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS content_type VARCHAR(255);
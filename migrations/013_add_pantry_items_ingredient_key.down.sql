@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_pantry_items_user_id_ingredient_key;
+ALTER TABLE pantry_items DROP COLUMN IF EXISTS ingredient_key;
+ALTER TABLE pantry_items ADD CONSTRAINT pantry_items_user_id_ingredient_key UNIQUE (user_id, ingredient);
@@ -0,0 +1,9 @@
+-- Pantry items are unique per user by normalized ingredient name, so that
+-- "Onions" and "2 chopped onions" are the same item. The server computes the
+-- key with the same normalization it matches recipes with, so rows older
+-- than this migration get theirs when the server next starts, which merges
+-- rows that turn out to be the same ingredient.
+ALTER TABLE pantry_items ADD COLUMN IF NOT EXISTS ingredient_key VARCHAR(255);
+
+ALTER TABLE pantry_items DROP CONSTRAINT IF EXISTS pantry_items_user_id_ingredient_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pantry_items_user_id_ingredient_key ON pantry_items(user_id, ingredient_key);
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// BackupHeader is the first line of a backup archive
+type BackupHeader struct {
+	Format                 string    `json:"format"`
+	FormatVersion          int       `json:"format_version"`
+	SchemaVersion          uint      `json:"schema_version"`
+	CreatedAt              time.Time `json:"created_at"`
+	IncludesPasswordHashes bool      `json:"includes_password_hashes"`
+	Tables                 []string  `json:"tables"`
+}
+
+// BackupOptions controls what a backup contains
+type BackupOptions struct {
+	IncludePasswordHashes bool
+}
+
+// RestoreSummary reports what a restore loaded
+type RestoreSummary struct {
+	SchemaVersion uint           `json:"schema_version"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Rows          map[string]int `json:"rows"`
+}
@@ -2,11 +2,68 @@ package models
 
 import "time"
 
-// Config represents the application configuration
+// Config represents the application configuration. Fields tagged
+// secret:"true" are redacted when the configuration is printed. Settings
+// for which 0 is meaningful are pointers, nil when left unset, so that an
+// explicit 0 is not mistaken for a missing value and replaced by the
+// default.
 type Config struct {
-	Database         DatabaseConfig `yaml:"database"`
-	JWTSecret        string         `yaml:"jwt_secret"`
-	TokenExpiryHours int            `yaml:"token_expiry_hours"`
+	ListenAddr string         `yaml:"listen_addr"`
+	DevMode    bool           `yaml:"dev_mode"`
+	LogLevel   string         `yaml:"log_level"`
+	Database   DatabaseConfig `yaml:"database"`
+	JWTSecret  string         `yaml:"jwt_secret" secret:"true"`
+
+	// SecretGraceHours is how long share links signed with the previous
+	// JWT secret are accepted after it changes; 0 rejects them at once
+	SecretGraceHours *int `yaml:"secret_grace_hours"`
+
+	TokenExpiryHours       int `yaml:"token_expiry_hours"`
+	IdempotencyKeyTTLHours int `yaml:"idempotency_key_ttl_hours"`
+
+	// RequestTimeoutSeconds bounds the work done for an API request; 0
+	// means no deadline
+	RequestTimeoutSeconds *int `yaml:"request_timeout_seconds"`
+
+	// HTTP server timeouts, and how long shutdown waits for in-flight
+	// requests before closing them
+	ReadTimeoutSeconds     int `yaml:"read_timeout_seconds"`
+	WriteTimeoutSeconds    int `yaml:"write_timeout_seconds"`
+	IdleTimeoutSeconds     int `yaml:"idle_timeout_seconds"`
+	ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds"`
+
+	Tracing TracingConfig `yaml:"tracing"`
+}
+
+// SecretGrace returns secret_grace_hours as a duration
+func (c *Config) SecretGrace() time.Duration {
+	return duration(c.SecretGraceHours, time.Hour)
+}
+
+// RequestTimeout returns request_timeout_seconds as a duration; 0 means no
+// deadline
+func (c *Config) RequestTimeout() time.Duration {
+	return duration(c.RequestTimeoutSeconds, time.Second)
+}
+
+// duration returns n units, or 0 if n is unset
+func duration(n *int, unit time.Duration) time.Duration {
+	if n == nil {
+		return 0
+	}
+	return time.Duration(*n) * unit
+}
+
+// TracingConfig selects where OpenTelemetry spans are exported
+type TracingConfig struct {
+	// Exporter is "none", "otlp" or "stdout"
+	Exporter string `yaml:"exporter"`
+
+	// Endpoint is the OTLP/HTTP traces URL, used by the otlp exporter
+	Endpoint string `yaml:"endpoint"`
+
+	// ServiceName identifies the server in the tracing backend
+	ServiceName string `yaml:"service_name"`
 }
 
 // DatabaseConfig represents database configuration
@@ -14,9 +71,16 @@ type DatabaseConfig struct {
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	User     string `yaml:"user"`
-	Password string `yaml:"password"`
+	Password string `yaml:"password" secret:"true"`
 	DBName   string `yaml:"dbname"`
 	SSLMode  string `yaml:"sslmode"`
+
+	// QueryTimeoutSeconds bounds each storage call; 0 means no bound
+	QueryTimeoutSeconds *int `yaml:"query_timeout_seconds"`
+
+	// Connection pool sizes
+	MaxOpenConns int `yaml:"max_open_conns"`
+	MaxIdleConns int `yaml:"max_idle_conns"`
 }
 
 // User represents a user in the database
@@ -26,6 +90,8 @@ type User struct {
 	Password  string    `json:"-" db:"password_hash"` // Don't expose password in JSON
 	Email     string    `json:"email" db:"email"`
 	IsActive  bool      `json:"is_active" db:"is_active"`
+	IsAdmin   bool      `json:"is_admin" db:"is_admin"`
+	Groups    []string  `json:"groups" db:"groups"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 	CreatedBy *int      `json:"created_by" db:"created_by"`
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// ReadinessCheck is the outcome of one of the checks behind /readyz
+type ReadinessCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Readiness is the response of /readyz. Ready is true only if every check
+// passed.
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// ServerStatus is the detailed status reported to administrators
+type ServerStatus struct {
+	Version               string            `json:"version"`
+	StartedAt             time.Time         `json:"started_at"`
+	UptimeSeconds         int64             `json:"uptime_seconds"`
+	SchemaVersion         uint              `json:"schema_version"`
+	ExpectedSchemaVersion uint              `json:"expected_schema_version"`
+	ActiveSessions        int               `json:"active_sessions"`
+	BackgroundJobsRunning bool              `json:"background_jobs_running"`
+	Database              DatabasePoolStats `json:"database"`
+}
+
+// DatabasePoolStats reports on the database connection pool, from
+// sql.DB.Stats
+type DatabasePoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMillis int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key header, replayed when the request is retried
+type IdempotencyRecord struct {
+	UserID       int       `json:"user_id" db:"user_id"`
+	Key          string    `json:"key" db:"key"`
+	RequestHash  string    `json:"request_hash" db:"request_hash"`
+	StatusCode   int       `json:"status_code" db:"status_code"` // 0 while the original request is in progress
+	ETag         string    `json:"etag" db:"etag"`
+	ContentType  string    `json:"content_type" db:"content_type"`
+	ResponseBody []byte    `json:"response_body" db:"response_body"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// IsComplete reports whether the original request has finished
+func (ir *IdempotencyRecord) IsComplete() bool {
+	return ir.StatusCode != 0
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ingredientFillerWords are connecting, size and preparation words that never
+// identify an ingredient (e.g. "chopped onions, to taste" -> "onion")
+var ingredientFillerWords = map[string]bool{
+	"and": true, "of": true, "or": true, "to": true, "taste": true,
+	"large": true, "medium": true, "small": true, "fresh": true,
+	"chopped": true, "diced": true, "minced": true, "sliced": true, "grated": true,
+	"peeled": true, "melted": true, "softened": true, "beaten": true,
+}
+
+// ingredientUnitWords are units and measures, dropped only when they follow
+// a quantity: "2 cloves garlic" -> "garlic", but "cloves" alone stays "clove"
+var ingredientUnitWords = map[string]bool{
+	"cup": true, "tablespoon": true, "tbsp": true, "teaspoon": true, "tsp": true,
+	"g": true, "gram": true, "kg": true, "kilogram": true, "mg": true,
+	"ml": true, "l": true, "liter": true, "litre": true, "oz": true, "ounce": true,
+	"lb": true, "lbs": true, "pound": true, "pinch": true, "dash": true, "clove": true,
+	"slice": true, "piece": true, "can": true, "package": true, "bunch": true,
+}
+
+// ingredientArticles count as a quantity of one ("a pinch of salt")
+var ingredientArticles = map[string]bool{"a": true, "an": true}
+
+// NormalizeIngredient reduces an ingredient line to a comparable form:
+// lowercased, punctuation and numbers removed, filler words dropped, unit
+// words dropped where they follow a quantity, and each remaining word
+// singularized. A line with nothing but a unit word, such as "Cloves",
+// keeps it.
+func NormalizeIngredient(ingredient string) string {
+	words := []string{}
+	afterQuantity := false
+	for _, token := range ingredientTokens(strings.ToLower(ingredient)) {
+		if unicode.IsNumber([]rune(token)[0]) || ingredientArticles[token] {
+			afterQuantity = true
+			continue
+		}
+
+		word := singularize(token)
+		switch {
+		case ingredientFillerWords[word]:
+			// Fillers between a quantity and its unit keep the quantity in effect
+		case afterQuantity && ingredientUnitWords[word]:
+			afterQuantity = false
+		default:
+			afterQuantity = false
+			words = append(words, word)
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// ingredientTokens splits text into runs of letters and runs of numbers, so
+// that "200g" gives "200" and "g" and punctuation separates words
+func ingredientTokens(text string) []string {
+	var tokens []string
+	start := -1
+	startNumber := false
+	for i, r := range text + " " {
+		isLetter, isNumber := unicode.IsLetter(r), unicode.IsNumber(r)
+		if start >= 0 && (!(isLetter || isNumber) || isNumber != startNumber) {
+			tokens = append(tokens, text[start:i])
+			start = -1
+		}
+		if start < 0 && (isLetter || isNumber) {
+			start, startNumber = i, isNumber
+		}
+	}
+	return tokens
+}
+
+// IngredientsMatch reports whether a normalized pantry item covers a
+// normalized recipe ingredient, i.e. the whole recipe ingredient appears as a
+// phrase within the pantry item ("brown sugar" covers "sugar", but "sugar"
+// does not cover "brown sugar" and "eggplant" does not cover "egg").
+func IngredientsMatch(recipe, pantry string) bool {
+	if recipe == "" || pantry == "" {
+		return false
+	}
+	return recipe == pantry || containsPhrase(pantry, recipe)
+}
+
+// containsPhrase reports whether phrase appears in text on word boundaries
+func containsPhrase(text, phrase string) bool {
+	return strings.Contains(" "+text+" ", " "+phrase+" ")
+}
+
+// singularize applies simple English plural rules to a single word
+func singularize(word string) string {
+	switch {
+	case len(word) <= 3:
+		return word
+	case strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "oes"),
+		strings.HasSuffix(word, "ches"),
+		strings.HasSuffix(word, "shes"),
+		strings.HasSuffix(word, "sses"),
+		strings.HasSuffix(word, "xes"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ss"),
+		strings.HasSuffix(word, "us"),
+		strings.HasSuffix(word, "is"):
+		return word
+	case strings.HasSuffix(word, "s"):
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
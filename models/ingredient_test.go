@@ -0,0 +1,68 @@
+package models
+
+import "testing"
+
+func TestNormalizeIngredient(t *testing.T) {
+	tests := []struct {
+		ingredient string
+		want       string
+	}{
+		{"Flour", "flour"},
+		{"2 cups flour", "flour"},
+		{"200g flour", "flour"},
+		{"½ cup sugar", "sugar"},
+		{"1 1/2 tbsp olive oil", "olive oil"},
+		{"2 large cloves garlic, minced", "garlic"},
+		{"a pinch of salt", "salt"},
+		{"Chopped onions, to taste", "onion"},
+		{"3 Tomatoes", "tomato"},
+		{"2 cans of tomatoes", "tomato"},
+		{"can of tomatoes", "can tomato"},
+		{"Cloves", "clove"},
+		{"Dash", "dash"},
+		{"salt and pepper", "salt pepper"},
+		{"berries", "berry"},
+		{"couscous", "couscous"},
+		{"", ""},
+		{"2", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ingredient, func(t *testing.T) {
+			if got := NormalizeIngredient(tt.ingredient); got != tt.want {
+				t.Errorf("NormalizeIngredient(%q) = %q, want %q", tt.ingredient, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngredientsMatch(t *testing.T) {
+	tests := []struct {
+		recipe, pantry string
+		want           bool
+	}{
+		{"sugar", "sugar", true},
+		{"sugar", "brown sugar", true},
+		{"brown sugar", "sugar", false},
+		{"egg", "eggplant", false},
+		{"oil", "olive oil", true},
+		{"olive oil", "oil", false},
+		{"oil", "soil", false},
+		{"pepper", "bell pepper", true},
+		{"bell pepper", "pepper", false},
+		{"cream", "ice cream", true},
+		{"ice cream", "cream", false},
+		{"oil", "sesame oil", true},
+		{"sesame oil", "oil", false},
+		{"", "sugar", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.recipe+"/"+tt.pantry, func(t *testing.T) {
+			if got := IngredientsMatch(tt.recipe, tt.pantry); got != tt.want {
+				t.Errorf("IngredientsMatch(%q, %q) = %v, want %v", tt.recipe, tt.pantry, got, tt.want)
+			}
+		})
+	}
+}
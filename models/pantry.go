@@ -0,0 +1,103 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// maxPantryQuantityLength is the length of the pantry_items.quantity column
+const maxPantryQuantityLength = 100
+
+// PantryItem represents an ingredient a user has on hand
+type PantryItem struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	Ingredient string     `json:"ingredient" db:"ingredient"`
+	Quantity   string     `json:"quantity" db:"quantity"`
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Validate checks if the pantry item has all required fields
+func (p *PantryItem) Validate() error {
+	if NormalizeIngredient(p.Ingredient) == "" {
+		return FieldErrors{{Field: "ingredient", Message: "ingredient is required"}}
+	}
+	return nil
+}
+
+// IsExpired reports whether the item is past its expiry date
+func (p *PantryItem) IsExpired(now time.Time) bool {
+	return p.ExpiresAt != nil && now.After(*p.ExpiresAt)
+}
+
+// MergePantryItems combines items of the same ingredient into the first of
+// them. The distinct quantities are joined with " + ", as far as they fit
+// the quantity column, and the earliest expiry is kept.
+func MergePantryItems(items []PantryItem) PantryItem {
+	merged := items[0]
+	merged.Quantity = ""
+	seen := make(map[string]bool)
+	for _, item := range items {
+		quantity := strings.TrimSpace(item.Quantity)
+		switch {
+		case quantity == "" || seen[quantity]:
+		case merged.Quantity == "":
+			merged.Quantity = quantity
+		case len(merged.Quantity)+len(" + ")+len(quantity) <= maxPantryQuantityLength:
+			merged.Quantity += " + " + quantity
+		}
+		seen[quantity] = true
+
+		if item.ExpiresAt != nil && (merged.ExpiresAt == nil || item.ExpiresAt.Before(*merged.ExpiresAt)) {
+			merged.ExpiresAt = item.ExpiresAt
+		}
+	}
+	return merged
+}
+
+// CookableRecipe describes how well a recipe can be cooked from a pantry
+type CookableRecipe struct {
+	Recipe       Recipe   `json:"recipe"`
+	MatchedCount int      `json:"matched_count"`
+	MissingCount int      `json:"missing_count"`
+	Missing      []string `json:"missing"`
+}
+
+// MatchPantry compares a recipe's ingredients against the given pantry items.
+// Expired items are ignored.
+func MatchPantry(recipe Recipe, pantry []PantryItem, now time.Time) CookableRecipe {
+	var available []string
+	for _, item := range pantry {
+		if item.IsExpired(now) {
+			continue
+		}
+		if normalized := NormalizeIngredient(item.Ingredient); normalized != "" {
+			available = append(available, normalized)
+		}
+	}
+
+	result := CookableRecipe{
+		Recipe:  recipe,
+		Missing: []string{},
+	}
+	for _, ingredient := range recipe.Ingredients {
+		normalized := NormalizeIngredient(ingredient)
+		found := false
+		for _, have := range available {
+			if IngredientsMatch(normalized, have) {
+				found = true
+				break
+			}
+		}
+		if found {
+			result.MatchedCount++
+		} else {
+			result.Missing = append(result.Missing, ingredient)
+		}
+	}
+	result.MissingCount = len(result.Missing)
+
+	return result
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergePantryItems(t *testing.T) {
+	june := time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC)
+	july := june.AddDate(0, 1, 0)
+	long := strings.Repeat("q", maxPantryQuantityLength-len("2 + "))
+
+	tests := []struct {
+		name         string
+		items        []PantryItem
+		wantQuantity string
+		wantExpires  *time.Time
+	}{
+		{
+			name:         "single item",
+			items:        []PantryItem{{ID: 1, Quantity: "2"}},
+			wantQuantity: "2",
+		},
+		{
+			name:         "quantities are joined",
+			items:        []PantryItem{{ID: 1, Quantity: "2"}, {ID: 2, Quantity: " 500g "}},
+			wantQuantity: "2 + 500g",
+		},
+		{
+			name:         "repeated and empty quantities are dropped",
+			items:        []PantryItem{{ID: 1}, {ID: 2, Quantity: "2"}, {ID: 3, Quantity: "2"}},
+			wantQuantity: "2",
+		},
+		{
+			name:         "quantities that do not fit are dropped",
+			items:        []PantryItem{{ID: 1, Quantity: "2"}, {ID: 2, Quantity: long + "q"}, {ID: 3, Quantity: long}},
+			wantQuantity: "2 + " + long,
+		},
+		{
+			name:        "earliest expiry is kept",
+			items:       []PantryItem{{ID: 1, ExpiresAt: &july}, {ID: 2}, {ID: 3, ExpiresAt: &june}},
+			wantExpires: &june,
+		},
+		{
+			name:        "expiry of a later item",
+			items:       []PantryItem{{ID: 1}, {ID: 2, ExpiresAt: &july}},
+			wantExpires: &july,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergePantryItems(tt.items)
+			if got.ID != tt.items[0].ID {
+				t.Errorf("MergePantryItems() ID = %d, want %d", got.ID, tt.items[0].ID)
+			}
+			if got.Quantity != tt.wantQuantity {
+				t.Errorf("MergePantryItems() quantity = %q, want %q", got.Quantity, tt.wantQuantity)
+			}
+			if (got.ExpiresAt == nil) != (tt.wantExpires == nil) || (got.ExpiresAt != nil && !got.ExpiresAt.Equal(*tt.wantExpires)) {
+				t.Errorf("MergePantryItems() expires_at = %v, want %v", got.ExpiresAt, tt.wantExpires)
+			}
+		})
+	}
+}
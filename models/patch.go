@@ -0,0 +1,141 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// MergePatchContentType is the media type of RFC 7396 JSON merge patches
+const MergePatchContentType = "application/merge-patch+json"
+
+// recipePatchFields lists the recipe JSON fields a patch may change, in
+// column order
+var recipePatchFields = []string{
+	"name", "ingredients", "instructions", "cooking_time", "servings", "category",
+	"visibility", "shared_with_users", "shared_with_groups",
+}
+
+// SharingFields lists the recipe fields only the creator may change
+var SharingFields = []string{"visibility", "shared_with_users", "shared_with_groups"}
+
+// ApplyMergePatch applies an RFC 7396 JSON merge patch object to a recipe and
+// returns the merged recipe. Members set to null are removed, so a required
+// field patched to null fails validation of the result. Patching fields that
+// are not in recipePatchFields is an error.
+func ApplyMergePatch(recipe Recipe, patch []byte) (Recipe, error) {
+	var patchDoc interface{}
+	if err := decodeJSON(patch, &patchDoc); err != nil {
+		return Recipe{}, fmt.Errorf("invalid merge patch: %v", err)
+	}
+	members, ok := patchDoc.(map[string]interface{})
+	if !ok {
+		return Recipe{}, errors.New("merge patch must be a JSON object")
+	}
+	for name := range members {
+		if !isPatchField(name) {
+			return Recipe{}, fmt.Errorf("field %s cannot be patched", name)
+		}
+	}
+
+	original, err := json.Marshal(recipe)
+	if err != nil {
+		return Recipe{}, err
+	}
+	var target interface{}
+	if err := decodeJSON(original, &target); err != nil {
+		return Recipe{}, err
+	}
+
+	merged, err := json.Marshal(mergePatch(target, patchDoc))
+	if err != nil {
+		return Recipe{}, err
+	}
+
+	var result Recipe
+	if err := json.Unmarshal(merged, &result); err != nil {
+		return Recipe{}, fmt.Errorf("invalid merge patch: %v", err)
+	}
+	return result, nil
+}
+
+// ChangedFields returns the patchable fields whose values differ between two
+// versions of a recipe
+func ChangedFields(before, after Recipe) []string {
+	values := func(recipe Recipe) map[string]interface{} {
+		return map[string]interface{}{
+			"name":               recipe.Name,
+			"ingredients":        nonNil(recipe.Ingredients),
+			"instructions":       recipe.Instructions,
+			"cooking_time":       recipe.CookingTime,
+			"servings":           recipe.Servings,
+			"category":           recipe.Category,
+			"visibility":         recipe.Visibility,
+			"shared_with_users":  nonNil(recipe.SharedWithUsers),
+			"shared_with_groups": nonNil(recipe.SharedWithGroups),
+		}
+	}
+
+	old, updated := values(before), values(after)
+	var changed []string
+	for _, field := range recipePatchFields {
+		if !reflect.DeepEqual(old[field], updated[field]) {
+			changed = append(changed, field)
+		}
+	}
+	return changed
+}
+
+// mergePatch implements the MergePatch function of RFC 7396 section 2
+func mergePatch(target, patch interface{}) interface{} {
+	patchMembers, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetMembers, ok := target.(map[string]interface{})
+	if !ok {
+		targetMembers = make(map[string]interface{})
+	}
+	for name, value := range patchMembers {
+		if value == nil {
+			delete(targetMembers, name)
+		} else {
+			targetMembers[name] = mergePatch(targetMembers[name], value)
+		}
+	}
+	return targetMembers
+}
+
+// decodeJSON decodes a single JSON value, keeping numbers exact
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// isPatchField reports whether a recipe field may be changed by a patch
+func isPatchField(name string) bool {
+	for _, field := range recipePatchFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// nonNil treats a nil slice as empty, as the database stores both the same way
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func patchBase() Recipe {
+	return Recipe{
+		ID:              "r1",
+		Name:            "Pancakes",
+		Ingredients:     []string{"flour", "milk", "egg"},
+		Instructions:    "Mix and fry.",
+		CookingTime:     "20 minutes",
+		Servings:        4,
+		Category:        "breakfast",
+		Visibility:      VisibilityShared,
+		SharedWithUsers: []string{"alice"},
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		want    func(*Recipe)
+		wantErr bool
+	}{
+		{
+			name:  "empty patch changes nothing",
+			patch: `{}`,
+			want:  func(*Recipe) {},
+		},
+		{
+			name:  "replaces scalar fields",
+			patch: `{"name": "Crêpes", "servings": 2}`,
+			want: func(r *Recipe) {
+				r.Name = "Crêpes"
+				r.Servings = 2
+			},
+		},
+		{
+			name:  "replaces arrays as a whole",
+			patch: `{"ingredients": ["flour", "water"]}`,
+			want:  func(r *Recipe) { r.Ingredients = []string{"flour", "water"} },
+		},
+		{
+			name:  "null removes a member",
+			patch: `{"shared_with_users": null}`,
+			want:  func(r *Recipe) { r.SharedWithUsers = nil },
+		},
+		{
+			name:  "null on a required field clears it",
+			patch: `{"instructions": null}`,
+			want:  func(r *Recipe) { r.Instructions = "" },
+		},
+		{
+			name:    "rejects fields that cannot be patched",
+			patch:   `{"version": 7}`,
+			wantErr: true,
+		},
+		{
+			name:    "rejects read-only fields",
+			patch:   `{"created_by": 2}`,
+			wantErr: true,
+		},
+		{
+			name:    "rejects a patch that is not an object",
+			patch:   `["name"]`,
+			wantErr: true,
+		},
+		{
+			name:    "rejects invalid JSON",
+			patch:   `{"name": `,
+			wantErr: true,
+		},
+		{
+			name:    "rejects trailing data",
+			patch:   `{"name": "a"} {"name": "b"}`,
+			wantErr: true,
+		},
+		{
+			name:    "rejects values of the wrong type",
+			patch:   `{"servings": "four"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyMergePatch(patchBase(), []byte(tt.patch))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ApplyMergePatch() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyMergePatch() error = %v", err)
+			}
+
+			want := patchBase()
+			tt.want(&want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ApplyMergePatch() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Recipe)
+		want   []string
+	}{
+		{
+			name:   "no change",
+			change: func(*Recipe) {},
+			want:   nil,
+		},
+		{
+			name:   "nil and empty slices are equal",
+			change: func(r *Recipe) { r.SharedWithGroups = []string{} },
+			want:   nil,
+		},
+		{
+			name:   "fields that cannot be patched are ignored",
+			change: func(r *Recipe) { r.ID = "r2" },
+			want:   nil,
+		},
+		{
+			name: "reported in column order",
+			change: func(r *Recipe) {
+				r.Visibility = VisibilityPrivate
+				r.Name = "Waffles"
+				r.Ingredients = append(r.Ingredients, "sugar")
+			},
+			want: []string{"name", "ingredients", "visibility"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := patchBase()
+			after.Ingredients = append([]string(nil), after.Ingredients...)
+			tt.change(&after)
+
+			if got := ChangedFields(patchBase(), after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChangedFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package models
+
+import "strings"
+
+// ProblemContentType is the media type of error responses (RFC 7807)
+const ProblemContentType = "application/problem+json"
+
+// Error codes identify the kind of problem in a Problem response. Clients
+// should match on these rather than on the human-readable detail.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeInvalidJSON          = "invalid_json"
+	CodeInvalidID            = "invalid_id"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeNotAcceptable        = "not_acceptable"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeInternalError        = "internal_error"
+	CodeServiceUnavailable   = "service_unavailable"
+	CodeTimeout              = "timeout"
+	CodeClientClosedRequest  = "client_closed_request"
+)
+
+// FieldError describes what is wrong with one field of a request
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// FieldErrors is the error returned by Validate methods, listing every
+// field that failed validation
+type FieldErrors []FieldError
+
+func (fe FieldErrors) Error() string {
+	messages := make([]string, len(fe))
+	for i, field := range fe {
+		messages[i] = field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Problem is an RFC 7807 problem details error response. Code is a stable,
+// machine-readable error code and Errors lists per-field validation
+// problems. RequestID is the X-Request-ID of the request, which finds its
+// lines in the server's logs. Success and Error repeat the outcome and
+// detail in the shape of the error responses that came before, for clients
+// written against them.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Code      string       `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Success   bool         `json:"success"`
+	Error     string       `json:"error"`
+}
@@ -1,44 +1,75 @@
 package models
 
-import (
-	"errors"
-	"time"
+import "time"
+
+// Recipe visibility levels
+const (
+	VisibilityPrivate = "private" // only the creator can see the recipe
+	VisibilityShared  = "shared"  // the creator plus the listed users and groups
+	VisibilityPublic  = "public"  // everyone, including unauthenticated visitors
 )
 
 // Recipe represents a recipe with all its details
 type Recipe struct {
-	ID           string    `json:"id" db:"id"`
-	Name         string    `json:"name" db:"name"`
-	Ingredients  []string  `json:"ingredients" db:"ingredients"`
-	Instructions string    `json:"instructions" db:"instructions"`
-	CookingTime  string    `json:"cooking_time" db:"cooking_time"`
-	Servings     int       `json:"servings" db:"servings"`
-	Category     string    `json:"category" db:"category"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
-	CreatedBy    *int      `json:"created_by" db:"created_by"`
-	UpdatedBy    *int      `json:"updated_by" db:"updated_by"`
+	ID               string    `json:"id" db:"id"`
+	Name             string    `json:"name" db:"name"`
+	Ingredients      []string  `json:"ingredients" db:"ingredients"`
+	Instructions     string    `json:"instructions" db:"instructions"`
+	CookingTime      string    `json:"cooking_time" db:"cooking_time"`
+	Servings         int       `json:"servings" db:"servings"`
+	Category         string    `json:"category" db:"category"`
+	Visibility       string    `json:"visibility" db:"visibility"`
+	SharedWithUsers  []string  `json:"shared_with_users" db:"shared_with_users"`   // usernames
+	SharedWithGroups []string  `json:"shared_with_groups" db:"shared_with_groups"` // group names
+	ForkedFrom       *string   `json:"forked_from" db:"forked_from"`
+	ForkCount        int       `json:"fork_count" db:"-"`
+	Version          int       `json:"version" db:"version"` // incremented on every change
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
+	CreatedBy        *int      `json:"created_by" db:"created_by"`
+	UpdatedBy        *int      `json:"updated_by" db:"updated_by"`
+}
+
+// PublicView returns the recipe as shown to anyone reaching it through a share
+// link or as a public recipe: without the users and groups it is shared with
+// or the IDs of the users who created and last changed it
+func (r Recipe) PublicView() Recipe {
+	r.SharedWithUsers = []string{}
+	r.SharedWithGroups = []string{}
+	r.CreatedBy = nil
+	r.UpdatedBy = nil
+	return r
 }
 
-// Validate checks if the recipe has all required fields
+// Validate checks if the recipe has all required fields, returning
+// FieldErrors listing every field that is missing or invalid
 func (r *Recipe) Validate() error {
+	var problems FieldErrors
 	if r.Name == "" {
-		return errors.New("recipe name is required")
+		problems = append(problems, FieldError{Field: "name", Message: "recipe name is required"})
 	}
 	if len(r.Ingredients) == 0 {
-		return errors.New("at least one ingredient is required")
+		problems = append(problems, FieldError{Field: "ingredients", Message: "at least one ingredient is required"})
 	}
 	if r.Instructions == "" {
-		return errors.New("instructions are required")
+		problems = append(problems, FieldError{Field: "instructions", Message: "instructions are required"})
 	}
 	if r.CookingTime == "" {
-		return errors.New("cooking time is required")
+		problems = append(problems, FieldError{Field: "cooking_time", Message: "cooking time is required"})
 	}
 	if r.Servings <= 0 {
-		return errors.New("servings must be greater than 0")
+		problems = append(problems, FieldError{Field: "servings", Message: "servings must be greater than 0"})
 	}
 	if r.Category == "" {
-		return errors.New("category is required")
+		problems = append(problems, FieldError{Field: "category", Message: "category is required"})
+	}
+	switch r.Visibility {
+	case VisibilityPrivate, VisibilityShared, VisibilityPublic:
+	default:
+		problems = append(problems, FieldError{Field: "visibility", Message: "visibility must be one of private, shared or public"})
+	}
+	if len(problems) > 0 {
+		return problems
 	}
 	return nil
 }
@@ -51,24 +82,15 @@ type APIResponse struct {
 	Error   string      `json:"error,omitempty"`
 }
 
-// APIError represents an API error response
-type APIError struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
-}
-
 // LoginRequest represents a login request
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
 
-// LoginResponse represents a login response
+// LoginResponse represents the data of a successful login response
 type LoginResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Token   string `json:"token,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Token string `json:"token"`
 }
 
 // LogoutRequest represents a logout request
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// ShareLink represents an expiring, revocable read-only link to a recipe
+type ShareLink struct {
+	ID        string     `json:"id" db:"id"`
+	RecipeID  string     `json:"recipe_id" db:"recipe_id"`
+	Token     string     `json:"token,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	CreatedBy *int       `json:"created_by" db:"created_by"`
+}
+
+// IsActive reports whether the link can still be used
+func (sl *ShareLink) IsActive(now time.Time) bool {
+	return sl.RevokedAt == nil && now.Before(sl.ExpiresAt)
+}
+
+// ShareLinkRequest represents a request to create a share link
+type ShareLinkRequest struct {
+	ExpiresInHours int `json:"expires_in_hours"`
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Weights of the two similarity measures in a similarity score
+const (
+	nameSimilarityWeight    = 0.4
+	ingredientOverlapWeight = 0.6
+)
+
+// DuplicateScoreThreshold is the similarity score at which the duplicate
+// detection job flags two recipes as likely duplicates
+const DuplicateScoreThreshold = 0.75
+
+// SimilarRecipe is a recipe scored by how similar it is to another
+type SimilarRecipe struct {
+	Recipe            Recipe  `json:"recipe"`
+	Score             float64 `json:"score"`
+	NameSimilarity    float64 `json:"name_similarity"`
+	IngredientOverlap float64 `json:"ingredient_overlap"`
+}
+
+// DuplicateCandidate is a pair of recipes that look like duplicates.
+// RecipeID is the older of the two.
+type DuplicateCandidate struct {
+	RecipeID      string    `json:"recipe_id"`
+	RecipeName    string    `json:"recipe_name,omitempty"`
+	DuplicateID   string    `json:"duplicate_id"`
+	DuplicateName string    `json:"duplicate_name,omitempty"`
+	Score         float64   `json:"score"`
+	DetectedAt    time.Time `json:"detected_at"`
+}
+
+// MergeRequest represents a request to fold the source recipe into another,
+// deleting the source
+type MergeRequest struct {
+	SourceID string `json:"source_id"`
+}
+
+// Similarity scores how alike two recipes are, from 0 to 1, combining
+// normalized name similarity and ingredient-set Jaccard overlap
+func Similarity(a, b Recipe) SimilarRecipe {
+	name := NameSimilarity(a.Name, b.Name)
+	overlap := IngredientOverlap(a.Ingredients, b.Ingredients)
+
+	return SimilarRecipe{
+		Recipe:            b,
+		Score:             nameSimilarityWeight*name + ingredientOverlapWeight*overlap,
+		NameSimilarity:    name,
+		IngredientOverlap: overlap,
+	}
+}
+
+// FindSimilar scores every other recipe against the given one and returns
+// those scoring at least minScore, most similar first
+func FindSimilar(recipe Recipe, candidates []Recipe, minScore float64) []SimilarRecipe {
+	similar := []SimilarRecipe{}
+	for _, candidate := range candidates {
+		if candidate.ID == recipe.ID {
+			continue
+		}
+		if match := Similarity(recipe, candidate); match.Score >= minScore {
+			similar = append(similar, match)
+		}
+	}
+
+	sort.SliceStable(similar, func(i, j int) bool {
+		return similar[i].Score > similar[j].Score
+	})
+	return similar
+}
+
+// FindDuplicates compares every pair of recipes and returns the pairs scoring
+// at least minScore
+func FindDuplicates(recipes []Recipe, minScore float64, now time.Time) []DuplicateCandidate {
+	var duplicates []DuplicateCandidate
+	for i := range recipes {
+		for j := i + 1; j < len(recipes); j++ {
+			a, b := recipes[i], recipes[j]
+			match := Similarity(a, b)
+			if match.Score < minScore {
+				continue
+			}
+			if b.CreatedAt.Before(a.CreatedAt) {
+				a, b = b, a
+			}
+			duplicates = append(duplicates, DuplicateCandidate{
+				RecipeID:    a.ID,
+				DuplicateID: b.ID,
+				Score:       match.Score,
+				DetectedAt:  now,
+			})
+		}
+	}
+	return duplicates
+}
+
+// NameSimilarity compares two recipe names after normalizing case, punctuation
+// and whitespace, returning 1 - (edit distance / longer length)
+func NameSimilarity(a, b string) float64 {
+	ra := []rune(normalizeName(a))
+	rb := []rune(normalizeName(b))
+
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 0
+	}
+
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// IngredientOverlap returns the Jaccard index of two ingredient lists, after
+// normalizing each ingredient with NormalizeIngredient
+func IngredientOverlap(a, b []string) float64 {
+	setA := ingredientSet(a)
+	setB := ingredientSet(b)
+
+	union := len(setA)
+	intersection := 0
+	for ingredient := range setB {
+		if setA[ingredient] {
+			intersection++
+		} else {
+			union++
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+
+	return float64(intersection) / float64(union)
+}
+
+// ingredientSet returns the set of normalized ingredients
+func ingredientSet(ingredients []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, ingredient := range ingredients {
+		if normalized := NormalizeIngredient(ingredient); normalized != "" {
+			set[normalized] = true
+		}
+	}
+	return set
+}
+
+// normalizeName lowercases a name and reduces it to letters, digits and single spaces
+func normalizeName(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// levenshtein returns the edit distance between two rune slices
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// approxEqual reports whether two scores are equal up to rounding
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"Pancakes", "Pancakes", 1},
+		{"Pancakes!", "  pancakes ", 1},
+		{"Banana-Bread", "banana bread", 1},
+		{"Pancake", "Pancakes", 1 - 1.0/8},
+		{"abc", "xyz", 0},
+		{"Soup", "", 0},
+		{"", "", 0},
+		{"Crème brûlée", "creme brulee", 1 - 3.0/12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			if got := NameSimilarity(tt.a, tt.b); !approxEqual(got, tt.want) {
+				t.Errorf("NameSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if got := NameSimilarity(tt.b, tt.a); !approxEqual(got, tt.want) {
+				t.Errorf("NameSimilarity(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngredientOverlap(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want float64
+	}{
+		{
+			name: "identical after normalizing",
+			a:    []string{"2 cups flour", "1 egg"},
+			b:    []string{"flour", "3 large eggs"},
+			want: 1,
+		},
+		{
+			name: "partial overlap",
+			a:    []string{"flour", "milk", "egg"},
+			b:    []string{"flour", "milk", "sugar", "butter"},
+			want: 2.0 / 5,
+		},
+		{
+			name: "duplicates count once",
+			a:    []string{"salt", "a pinch of salt"},
+			b:    []string{"salt"},
+			want: 1,
+		},
+		{
+			name: "disjoint",
+			a:    []string{"rice"},
+			b:    []string{"pasta"},
+			want: 0,
+		},
+		{
+			name: "both empty",
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IngredientOverlap(tt.a, tt.b); !approxEqual(got, tt.want) {
+				t.Errorf("IngredientOverlap(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	a := Recipe{ID: "a", Name: "Pancakes", Ingredients: []string{"flour", "milk", "egg"}}
+	b := Recipe{ID: "b", Name: "Pancake", Ingredients: []string{"flour", "milk", "sugar", "butter"}}
+
+	got := Similarity(a, b)
+	wantName, wantOverlap := 1-1.0/8, 2.0/5
+	if got.Recipe.ID != "b" || !approxEqual(got.NameSimilarity, wantName) || !approxEqual(got.IngredientOverlap, wantOverlap) {
+		t.Fatalf("Similarity() = %+v, want name %v and overlap %v for b", got, wantName, wantOverlap)
+	}
+	if want := 0.4*wantName + 0.6*wantOverlap; !approxEqual(got.Score, want) {
+		t.Errorf("Similarity() score = %v, want %v", got.Score, want)
+	}
+}
+
+func TestFindSimilar(t *testing.T) {
+	recipe := Recipe{ID: "r", Name: "Tomato Soup", Ingredients: []string{"tomato", "onion", "stock"}}
+	candidates := []Recipe{
+		recipe,
+		{ID: "weak", Name: "Tomato Salad", Ingredients: []string{"tomato", "lettuce"}},
+		{ID: "same", Name: "Tomato soup", Ingredients: []string{"3 tomatoes", "1 onion", "stock"}},
+		{ID: "none", Name: "Bread", Ingredients: []string{"flour"}},
+	}
+
+	tests := []struct {
+		name     string
+		minScore float64
+		want     []string
+	}{
+		{name: "everything but itself, most similar first", minScore: 0, want: []string{"same", "weak", "none"}},
+		{name: "filtered by score", minScore: 0.5, want: []string{"same"}},
+		{name: "nothing scores above 1", minScore: 1.1, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := []string{}
+			for _, match := range FindSimilar(recipe, candidates, tt.minScore) {
+				ids = append(ids, match.Recipe.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("FindSimilar() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	older := now.Add(-time.Hour)
+	recipes := []Recipe{
+		{ID: "new", Name: "Chili", Ingredients: []string{"beans", "beef", "chili"}, CreatedAt: now},
+		{ID: "old", Name: "Chili!", Ingredients: []string{"2 cans beans", "beef", "chili"}, CreatedAt: older},
+		{ID: "other", Name: "Porridge", Ingredients: []string{"oats", "milk"}, CreatedAt: older},
+	}
+
+	got := FindDuplicates(recipes, DuplicateScoreThreshold, now)
+	want := []DuplicateCandidate{{RecipeID: "old", DuplicateID: "new", Score: 1, DetectedAt: now}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindDuplicates() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,176 @@
+package recipeformat
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"recipe-api/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IngredientSeparator separates ingredients within the CSV ingredients
+// column. A separator or backslash within an ingredient is escaped with a
+// backslash.
+const IngredientSeparator = "|"
+
+// ingredientEscaper escapes backslashes and separators within an ingredient
+var ingredientEscaper = strings.NewReplacer(`\`, `\\`, IngredientSeparator, `\`+IngredientSeparator)
+
+// formulaPrefixes are the characters that make a spreadsheet evaluate a cell
+// as a formula. Exported cells starting with one are prefixed with a quote,
+// which imports strip again.
+const formulaPrefixes = "=+-@"
+
+// CSVHeader lists the columns written by WriteCSVRecipe. Imports require the
+// name, ingredients, instructions, cooking_time, servings and category
+// columns; the others are optional and id, timestamps and unknown columns are
+// ignored.
+var CSVHeader = []string{
+	"id", "name", "ingredients", "instructions", "cooking_time", "servings", "category",
+	"visibility", "created_at", "updated_at",
+}
+
+// requiredCSVColumns must be present in an imported CSV header
+var requiredCSVColumns = []string{"name", "ingredients", "instructions", "cooking_time", "servings", "category"}
+
+// CSVRecipe is a recipe parsed from one CSV row
+type CSVRecipe struct {
+	Row    int // spreadsheet row number, the header being row 1
+	Recipe models.Recipe
+	Err    error // set when the row could not be parsed
+}
+
+// WriteCSVRecipe writes a recipe as one CSV row in CSVHeader order
+func WriteCSVRecipe(w *csv.Writer, recipe models.Recipe) error {
+	ingredients := make([]string, len(recipe.Ingredients))
+	for i, ingredient := range recipe.Ingredients {
+		ingredients[i] = ingredientEscaper.Replace(ingredient)
+	}
+
+	record := []string{
+		recipe.ID,
+		recipe.Name,
+		strings.Join(ingredients, IngredientSeparator),
+		recipe.Instructions,
+		recipe.CookingTime,
+		strconv.Itoa(recipe.Servings),
+		recipe.Category,
+		recipe.Visibility,
+		recipe.CreatedAt.UTC().Format(time.RFC3339),
+		recipe.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	for i, cell := range record {
+		if cell != "" && strings.ContainsRune(formulaPrefixes, rune(cell[0])) {
+			record[i] = "'" + cell
+		}
+	}
+	return w.Write(record)
+}
+
+// unquoteFormula removes the quote WriteCSVRecipe puts before a cell that
+// would otherwise be evaluated as a formula
+func unquoteFormula(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+// splitIngredients splits a CSV ingredients column at unescaped separators,
+// dropping empty ingredients
+func splitIngredients(column string) []string {
+	var ingredients []string
+	var ingredient strings.Builder
+	add := func() {
+		if trimmed := strings.TrimSpace(ingredient.String()); trimmed != "" {
+			ingredients = append(ingredients, trimmed)
+		}
+		ingredient.Reset()
+	}
+
+	for i := 0; i < len(column); i++ {
+		switch {
+		case column[i] == '\\' && i+1 < len(column):
+			i++
+			ingredient.WriteByte(column[i])
+		case strings.HasPrefix(column[i:], IngredientSeparator):
+			add()
+		default:
+			ingredient.WriteByte(column[i])
+		}
+	}
+	add()
+
+	return ingredients
+}
+
+// ReadCSVRecipes parses a CSV document with a header row into recipes. Errors
+// in individual rows are reported on the row; an error is returned only when
+// the document as a whole cannot be read.
+func ReadCSVRecipes(r io.Reader) ([]CSVRecipe, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("CSV document is empty")
+		}
+		return nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range requiredCSVColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %s column", name)
+		}
+	}
+
+	var recipes []CSVRecipe
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, fmt.Errorf("failed to read CSV: %v", err)
+			}
+			recipes = append(recipes, CSVRecipe{Row: row, Err: err})
+			continue
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return unquoteFormula(strings.TrimSpace(record[i]))
+			}
+			return ""
+		}
+
+		parsed := CSVRecipe{Row: row}
+		parsed.Recipe = models.Recipe{
+			Name:         field("name"),
+			Instructions: field("instructions"),
+			CookingTime:  field("cooking_time"),
+			Category:     field("category"),
+			Visibility:   field("visibility"),
+		}
+		parsed.Recipe.Ingredients = splitIngredients(field("ingredients"))
+		if servings := field("servings"); servings != "" {
+			parsed.Recipe.Servings, err = strconv.Atoi(servings)
+			if err != nil {
+				parsed.Err = fmt.Errorf("servings must be a whole number, got %q", servings)
+			}
+		}
+
+		recipes = append(recipes, parsed)
+	}
+
+	return recipes, nil
+}
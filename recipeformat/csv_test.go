@@ -0,0 +1,199 @@
+package recipeformat
+
+import (
+	"bytes"
+	"encoding/csv"
+	"recipe-api/models"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSVRecipes(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     []CSVRecipe
+		wantErr  bool
+		badRows  []int
+	}{
+		{
+			name: "columns in any order and case",
+			document: "Category, NAME,ingredients,instructions,cooking_time,servings,extra\n" +
+				"soup,Tomato Soup, tomatoes | onion ||,Simmer.,30 minutes,4,ignored\n",
+			want: []CSVRecipe{{Row: 2, Recipe: models.Recipe{
+				Name:         "Tomato Soup",
+				Ingredients:  []string{"tomatoes", "onion"},
+				Instructions: "Simmer.",
+				CookingTime:  "30 minutes",
+				Servings:     4,
+				Category:     "soup",
+			}}},
+		},
+		{
+			name: "optional visibility and short rows",
+			document: "name,ingredients,instructions,cooking_time,servings,category,visibility\n" +
+				"Toast,bread,Toast it.,5 minutes,1,breakfast,public\n" +
+				"Tea\n",
+			want: []CSVRecipe{
+				{Row: 2, Recipe: models.Recipe{
+					Name:         "Toast",
+					Ingredients:  []string{"bread"},
+					Instructions: "Toast it.",
+					CookingTime:  "5 minutes",
+					Servings:     1,
+					Category:     "breakfast",
+					Visibility:   "public",
+				}},
+				{Row: 3, Recipe: models.Recipe{Name: "Tea"}},
+			},
+		},
+		{
+			name: "escaped separators and formula cells",
+			document: "name,ingredients,instructions,cooking_time,servings,category\n" +
+				`"'=HYPERLINK(""x"")",salt \| pepper|oil\\vinegar,'-Stir.,'Nduja,2,'@home` + "\n",
+			want: []CSVRecipe{{Row: 2, Recipe: models.Recipe{
+				Name:         `=HYPERLINK("x")`,
+				Ingredients:  []string{"salt | pepper", `oil\vinegar`},
+				Instructions: "-Stir.",
+				CookingTime:  "'Nduja",
+				Servings:     2,
+				Category:     "@home",
+			}}},
+		},
+		{
+			name: "row errors are reported on the row",
+			document: "name,ingredients,instructions,cooking_time,servings,category\n" +
+				"Toast,bread,Toast it.,5 minutes,one,breakfast\n" +
+				"\"Broken,bread,Toast it.,5 minutes,1,breakfast\n",
+			badRows: []int{2, 3},
+		},
+		{
+			name:     "empty document",
+			document: "",
+			wantErr:  true,
+		},
+		{
+			name:     "missing required column",
+			document: "name,ingredients,instructions,cooking_time,servings\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadCSVRecipes(strings.NewReader(tt.document))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ReadCSVRecipes() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadCSVRecipes() error = %v", err)
+			}
+
+			if tt.badRows != nil {
+				var badRows []int
+				for _, parsed := range got {
+					if parsed.Err != nil {
+						badRows = append(badRows, parsed.Row)
+					}
+				}
+				if !reflect.DeepEqual(badRows, tt.badRows) {
+					t.Errorf("ReadCSVRecipes() rows with errors = %v, want %v", badRows, tt.badRows)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadCSVRecipes() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	base := models.Recipe{
+		ID:           "r1",
+		Name:         `Grandma's "Best" Pie`,
+		Ingredients:  []string{"flour", "butter, cold", "apples"},
+		Instructions: "1. Make the crust.\n2. Bake.",
+		CookingTime:  "1 hour",
+		Servings:     8,
+		Category:     "dessert",
+		Visibility:   "private",
+		CreatedAt:    time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+		UpdatedAt:    time.Date(2024, 3, 2, 9, 30, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name   string
+		change func(*models.Recipe)
+		// wantCells are cells expected verbatim in the CSV
+		wantCells []string
+	}{
+		{name: "plain recipe", change: func(*models.Recipe) {}},
+		{
+			name:      "separators and backslashes in ingredients",
+			change:    func(r *models.Recipe) { r.Ingredients = []string{"salt | pepper", `C:\pantry`, "|"} },
+			wantCells: []string{`salt \| pepper|C:\\pantry|\|`},
+		},
+		{
+			name: "cells a spreadsheet would evaluate",
+			change: func(r *models.Recipe) {
+				r.Name = "=1+1"
+				r.Ingredients = []string{"+2 eggs", "milk"}
+				r.Instructions = "-Mix."
+				r.Category = "@cmd"
+				r.Servings = -1
+			},
+			wantCells: []string{"'=1+1", "'+2 eggs|milk", "'-Mix.", "'@cmd", "'-1"},
+		},
+		{
+			name:   "leading quote without a formula",
+			change: func(r *models.Recipe) { r.Name = "'Nduja pasta" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipe := base
+			tt.change(&recipe)
+
+			var buf bytes.Buffer
+			w := csv.NewWriter(&buf)
+			if err := w.Write(CSVHeader); err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteCSVRecipe(w, recipe); err != nil {
+				t.Fatalf("WriteCSVRecipe() error = %v", err)
+			}
+			w.Flush()
+
+			records, err := csv.NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, cell := range tt.wantCells {
+				if !slices.Contains(records[1], cell) {
+					t.Errorf("WriteCSVRecipe() = %q, want a cell %q", records[1], cell)
+				}
+			}
+
+			got, err := ReadCSVRecipes(&buf)
+			if err != nil {
+				t.Fatalf("ReadCSVRecipes() error = %v", err)
+			}
+
+			// IDs and timestamps are assigned on import
+			want := recipe
+			want.ID = ""
+			want.CreatedAt, want.UpdatedAt = time.Time{}, time.Time{}
+			if len(got) != 1 || got[0].Err != nil || !reflect.DeepEqual(got[0].Recipe, want) {
+				t.Errorf("round trip = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package recipeformat
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isoDurationPattern matches the ISO-8601 durations used by schema.org (e.g. PT1H30M, P1DT2H)
+var isoDurationPattern = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// ParseISODuration parses an ISO-8601 duration such as "PT1H30M"
+func ParseISODuration(value string) (time.Duration, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	match := isoDurationPattern.FindStringSubmatch(value)
+	if match == nil || value == "P" || value == "PT" {
+		return 0, fmt.Errorf("invalid ISO-8601 duration %q", value)
+	}
+
+	var total time.Duration
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute}
+	for i, unit := range units {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO-8601 duration %q", value)
+		}
+		total += time.Duration(n) * unit
+	}
+	if match[4] != "" {
+		seconds, err := strconv.ParseFloat(match[4], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO-8601 duration %q", value)
+		}
+		total += time.Duration(seconds * float64(time.Second))
+	}
+
+	return total, nil
+}
+
+// FormatCookingTime renders a duration in the style used for Recipe.CookingTime,
+// e.g. "1 hour 30 minutes"
+func FormatCookingTime(d time.Duration) string {
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+
+	var parts []string
+	if hours > 0 {
+		parts = append(parts, plural(hours, "hour"))
+	}
+	if minutes > 0 || hours == 0 {
+		parts = append(parts, plural(minutes, "minute"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// plural formats a count with a singular or plural unit
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// cookingTimePattern matches amounts in free-form cooking times such as "1 hour 30 mins"
+var cookingTimePattern = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(days?|d|hours?|hrs?|h|minutes?|mins?|m)\b`)
+
+// ParseCookingTime parses a free-form Recipe.CookingTime such as "45 minutes"
+// or "1 hour 30 mins". A bare number is taken as minutes.
+func ParseCookingTime(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if minutes, err := strconv.Atoi(value); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute, true
+	}
+
+	var total time.Duration
+	for _, match := range cookingTimePattern.FindAllStringSubmatch(value, -1) {
+		amount, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return 0, false
+		}
+		unit := time.Minute
+		switch strings.ToLower(match[2])[0] {
+		case 'd':
+			unit = 24 * time.Hour
+		case 'h':
+			unit = time.Hour
+		}
+		total += time.Duration(amount * float64(unit))
+	}
+	return total, total > 0
+}
+
+// FormatISODuration renders a duration as ISO-8601, e.g. "PT1H30M"
+func FormatISODuration(d time.Duration) string {
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+
+	result := "PT"
+	if hours > 0 {
+		result += fmt.Sprintf("%dH", hours)
+	}
+	if minutes > 0 || hours == 0 {
+		result += fmt.Sprintf("%dM", minutes)
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package recipeformat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "PT30M", want: 30 * time.Minute},
+		{value: "PT1H30M", want: 90 * time.Minute},
+		{value: "PT2H", want: 2 * time.Hour},
+		{value: "P1DT2H", want: 26 * time.Hour},
+		{value: "P1D", want: 24 * time.Hour},
+		{value: "PT45S", want: 45 * time.Second},
+		{value: "PT1.5S", want: 1500 * time.Millisecond},
+		{value: " pt10m ", want: 10 * time.Minute},
+		{value: "PT0M", want: 0},
+		{value: "", wantErr: true},
+		{value: "P", wantErr: true},
+		{value: "PT", wantErr: true},
+		{value: "30 minutes", wantErr: true},
+		{value: "PT1M30H", wantErr: true},
+		{value: "P1W", wantErr: true},
+		{value: "-PT5M", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseISODuration(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseISODuration(%q) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseISODuration(%q) error = %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseISODuration(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatISODuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "PT0M"},
+		{45 * time.Minute, "PT45M"},
+		{time.Hour, "PT1H"},
+		{90 * time.Minute, "PT1H30M"},
+		{26 * time.Hour, "PT26H"},
+		{90 * time.Second, "PT1M"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := FormatISODuration(tt.d); got != tt.want {
+				t.Errorf("FormatISODuration(%v) = %q, want %q", tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCookingTime(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: "45", want: 45 * time.Minute, wantOK: true},
+		{value: "45 minutes", want: 45 * time.Minute, wantOK: true},
+		{value: "1 hour 30 mins", want: 90 * time.Minute, wantOK: true},
+		{value: "2 hrs", want: 2 * time.Hour, wantOK: true},
+		{value: "1.5 hours", want: 90 * time.Minute, wantOK: true},
+		{value: "1 day", want: 24 * time.Hour, wantOK: true},
+		{value: "10m", want: 10 * time.Minute, wantOK: true},
+		{value: "0", wantOK: false},
+		{value: "overnight", wantOK: false},
+		{value: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := ParseCookingTime(tt.value)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("ParseCookingTime(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFormatCookingTime(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0 minutes"},
+		{time.Minute, "1 minute"},
+		{45 * time.Minute, "45 minutes"},
+		{time.Hour, "1 hour"},
+		{61 * time.Minute, "1 hour 1 minute"},
+		{150 * time.Minute, "2 hours 30 minutes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := FormatCookingTime(tt.d); got != tt.want {
+				t.Errorf("FormatCookingTime(%v) = %q, want %q", tt.d, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package recipeformat
+
+import (
+	"encoding/json"
+	"fmt"
+	"recipe-api/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Export formats supported by Export
+const (
+	FormatJSON     = "json"
+	FormatJSONLD   = "jsonld"
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+)
+
+// ContentTypes maps each export format to its response Content-Type
+var ContentTypes = map[string]string{
+	FormatJSON:     "application/json",
+	FormatJSONLD:   "application/ld+json",
+	FormatMarkdown: "text/markdown; charset=utf-8",
+	FormatText:     "text/plain; charset=utf-8",
+}
+
+// stepNumberPattern matches a leading step number such as "1." or "2)"
+var stepNumberPattern = regexp.MustCompile(`(?i)^\s*(?:step\s*)?\d+[.):]\s*`)
+
+// JSONLDRecipe is a schema.org Recipe node
+type JSONLDRecipe struct {
+	Context            string       `json:"@context"`
+	Type               string       `json:"@type"`
+	Identifier         string       `json:"identifier,omitempty"`
+	Name               string       `json:"name"`
+	RecipeCategory     string       `json:"recipeCategory,omitempty"`
+	RecipeYield        string       `json:"recipeYield,omitempty"`
+	TotalTime          string       `json:"totalTime,omitempty"`
+	RecipeIngredient   []string     `json:"recipeIngredient"`
+	RecipeInstructions []JSONLDStep `json:"recipeInstructions"`
+	DateCreated        string       `json:"dateCreated,omitempty"`
+	DateModified       string       `json:"dateModified,omitempty"`
+}
+
+// JSONLDStep is a schema.org HowToStep node
+type JSONLDStep struct {
+	Type string `json:"@type"`
+	Text string `json:"text"`
+}
+
+// InstructionSteps splits Recipe.Instructions into individual steps, one per
+// non-empty line, with any leading step numbers removed
+func InstructionSteps(instructions string) []string {
+	var steps []string
+	for _, line := range strings.Split(instructions, "\n") {
+		line = strings.TrimSpace(stepNumberPattern.ReplaceAllString(line, ""))
+		if line != "" {
+			steps = append(steps, line)
+		}
+	}
+	return steps
+}
+
+// ToJSONLD maps a recipe onto a schema.org Recipe node
+func ToJSONLD(recipe models.Recipe) JSONLDRecipe {
+	node := JSONLDRecipe{
+		Context:            "https://schema.org",
+		Type:               "Recipe",
+		Identifier:         recipe.ID,
+		Name:               recipe.Name,
+		RecipeCategory:     recipe.Category,
+		RecipeIngredient:   recipe.Ingredients,
+		RecipeInstructions: []JSONLDStep{},
+	}
+	if node.RecipeIngredient == nil {
+		node.RecipeIngredient = []string{}
+	}
+
+	if recipe.Servings > 0 {
+		node.RecipeYield = plural(recipe.Servings, "serving")
+	}
+	if total, ok := ParseCookingTime(recipe.CookingTime); ok {
+		node.TotalTime = FormatISODuration(total)
+	}
+	for _, step := range InstructionSteps(recipe.Instructions) {
+		node.RecipeInstructions = append(node.RecipeInstructions, JSONLDStep{Type: "HowToStep", Text: step})
+	}
+	if !recipe.CreatedAt.IsZero() {
+		node.DateCreated = recipe.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	if !recipe.UpdatedAt.IsZero() {
+		node.DateModified = recipe.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+
+	return node
+}
+
+// MarshalJSONLD renders a recipe as a schema.org JSON-LD document
+func MarshalJSONLD(recipe models.Recipe) ([]byte, error) {
+	return json.MarshalIndent(ToJSONLD(recipe), "", "  ")
+}
+
+// ToMarkdown renders a recipe as a Markdown document
+func ToMarkdown(recipe models.Recipe) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", recipe.Name)
+	fmt.Fprintf(&b, "- **Category:** %s\n", recipe.Category)
+	fmt.Fprintf(&b, "- **Cooking time:** %s\n", recipe.CookingTime)
+	fmt.Fprintf(&b, "- **Servings:** %d\n", recipe.Servings)
+
+	b.WriteString("\n## Ingredients\n\n")
+	for _, ingredient := range recipe.Ingredients {
+		fmt.Fprintf(&b, "- %s\n", ingredient)
+	}
+
+	b.WriteString("\n## Instructions\n\n")
+	for i, step := range InstructionSteps(recipe.Instructions) {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, step)
+	}
+
+	return b.String()
+}
+
+// ToText renders a recipe as printable plain text
+func ToText(recipe models.Recipe) string {
+	var b strings.Builder
+
+	title := strings.ToUpper(recipe.Name)
+	fmt.Fprintf(&b, "%s\n%s\n\n", title, strings.Repeat("=", len([]rune(title))))
+	fmt.Fprintf(&b, "Category:     %s\n", recipe.Category)
+	fmt.Fprintf(&b, "Cooking time: %s\n", recipe.CookingTime)
+	fmt.Fprintf(&b, "Servings:     %d\n", recipe.Servings)
+
+	b.WriteString("\nINGREDIENTS\n\n")
+	for _, ingredient := range recipe.Ingredients {
+		fmt.Fprintf(&b, "  * %s\n", ingredient)
+	}
+
+	b.WriteString("\nINSTRUCTIONS\n\n")
+	for i, step := range InstructionSteps(recipe.Instructions) {
+		fmt.Fprintf(&b, "  %d. %s\n", i+1, step)
+	}
+
+	return b.String()
+}
+
+// Export renders a recipe in one of the non-JSON export formats
+func Export(recipe models.Recipe, format string) ([]byte, error) {
+	switch format {
+	case FormatJSONLD:
+		return MarshalJSONLD(recipe)
+	case FormatMarkdown:
+		return []byte(ToMarkdown(recipe)), nil
+	case FormatText:
+		return []byte(ToText(recipe)), nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
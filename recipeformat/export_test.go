@@ -0,0 +1,147 @@
+package recipeformat
+
+import (
+	"recipe-api/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestToJSONLD(t *testing.T) {
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	tests := []struct {
+		name   string
+		recipe models.Recipe
+		want   JSONLDRecipe
+	}{
+		{
+			name: "complete recipe",
+			recipe: models.Recipe{
+				ID:           "r1",
+				Name:         "Tomato Soup",
+				Ingredients:  []string{"4 tomatoes", "1 onion"},
+				Instructions: "1. Chop.\n\nStep 2: Simmer.\n3) Blend.",
+				CookingTime:  "1 hour 15 mins",
+				Servings:     4,
+				Category:     "soup",
+				CreatedAt:    created,
+				UpdatedAt:    created.Add(time.Hour),
+			},
+			want: JSONLDRecipe{
+				Context:          "https://schema.org",
+				Type:             "Recipe",
+				Identifier:       "r1",
+				Name:             "Tomato Soup",
+				RecipeCategory:   "soup",
+				RecipeYield:      "4 servings",
+				TotalTime:        "PT1H15M",
+				RecipeIngredient: []string{"4 tomatoes", "1 onion"},
+				RecipeInstructions: []JSONLDStep{
+					{Type: "HowToStep", Text: "Chop."},
+					{Type: "HowToStep", Text: "Simmer."},
+					{Type: "HowToStep", Text: "Blend."},
+				},
+				DateCreated:  "2024-03-01T08:30:00Z",
+				DateModified: "2024-03-01T09:30:00Z",
+			},
+		},
+		{
+			name:   "empty recipe keeps required arrays",
+			recipe: models.Recipe{Name: "Water", CookingTime: "a while", Servings: 1},
+			want: JSONLDRecipe{
+				Context:            "https://schema.org",
+				Type:               "Recipe",
+				Name:               "Water",
+				RecipeYield:        "1 serving",
+				RecipeIngredient:   []string{},
+				RecipeInstructions: []JSONLDStep{},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToJSONLD(tt.recipe); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ToJSONLD() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONLDRoundTrip(t *testing.T) {
+	recipe := models.Recipe{
+		Name:         "Pancakes",
+		Ingredients:  []string{"flour", "milk", "egg"},
+		Instructions: "Mix.\nFry.",
+		CookingTime:  "20 minutes",
+		Servings:     4,
+		Category:     "breakfast",
+	}
+
+	document, err := MarshalJSONLD(recipe)
+	if err != nil {
+		t.Fatalf("MarshalJSONLD() error = %v", err)
+	}
+	result, err := ImportJSONLD(document)
+	if err != nil {
+		t.Fatalf("ImportJSONLD() error = %v", err)
+	}
+
+	want := recipe
+	want.Instructions = "1. Mix.\n2. Fry."
+	if !reflect.DeepEqual(result.Recipe, want) {
+		t.Errorf("round trip = %+v, want %+v", result.Recipe, want)
+	}
+	if len(result.Missing) != 0 {
+		t.Errorf("round trip missing = %v, want none", result.Missing)
+	}
+}
+
+func TestExport(t *testing.T) {
+	recipe := models.Recipe{
+		Name:         "Toast",
+		Ingredients:  []string{"bread"},
+		Instructions: "Toast the bread.",
+		CookingTime:  "5 minutes",
+		Servings:     1,
+		Category:     "breakfast",
+	}
+
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			format: FormatMarkdown,
+			want: "# Toast\n\n- **Category:** breakfast\n- **Cooking time:** 5 minutes\n- **Servings:** 1\n" +
+				"\n## Ingredients\n\n- bread\n\n## Instructions\n\n1. Toast the bread.\n",
+		},
+		{
+			format: FormatText,
+			want: "TOAST\n=====\n\nCategory:     breakfast\nCooking time: 5 minutes\nServings:     1\n" +
+				"\nINGREDIENTS\n\n  * bread\n\nINSTRUCTIONS\n\n  1. Toast the bread.\n",
+		},
+		{format: FormatJSON, wantErr: true},
+		{format: "pdf", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := Export(recipe, tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Export(%q) = %q, want an error", tt.format, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Export(%q) error = %v", tt.format, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Export(%q) = %q, want %q", tt.format, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+// Package recipeformat converts recipes to and from external formats such as
+// schema.org JSON-LD.
+package recipeformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"recipe-api/models"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoRecipe is returned when a document does not contain a schema.org Recipe
+var ErrNoRecipe = errors.New("no schema.org Recipe found in document")
+
+// ldJSONScriptPattern matches <script type="application/ld+json"> blocks in an HTML page
+var ldJSONScriptPattern = regexp.MustCompile(`(?is)<script[^>]*type\s*=\s*["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+
+// firstNumberPattern matches the first integer in a string such as "4 servings"
+var firstNumberPattern = regexp.MustCompile(`\d+`)
+
+// ImportResult holds a recipe mapped from an external document
+type ImportResult struct {
+	Recipe   models.Recipe `json:"recipe"`
+	Unmapped []string      `json:"unmapped"` // source properties that were present but not mapped
+	Missing  []string      `json:"missing"`  // recipe fields that could not be filled
+}
+
+// ImportDocument maps a schema.org Recipe from either a JSON-LD document or
+// an HTML page embedding one in a <script type="application/ld+json"> block
+func ImportDocument(data []byte) (*ImportResult, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '<' {
+		return ImportHTML(trimmed)
+	}
+	return ImportJSONLD(trimmed)
+}
+
+// ImportHTML maps the first schema.org Recipe found in an HTML page's JSON-LD blocks
+func ImportHTML(data []byte) (*ImportResult, error) {
+	for _, match := range ldJSONScriptPattern.FindAllSubmatch(data, -1) {
+		result, err := ImportJSONLD(match[1])
+		if err == nil {
+			return result, nil
+		}
+	}
+	return nil, ErrNoRecipe
+}
+
+// ImportJSONLD maps a schema.org Recipe JSON-LD document onto a models.Recipe.
+// The Recipe may be the top-level object, an element of a top-level array or
+// part of an @graph.
+func ImportJSONLD(data []byte) (*ImportResult, error) {
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid JSON-LD: %v", err)
+	}
+
+	node := findRecipeNode(document)
+	if node == nil {
+		return nil, ErrNoRecipe
+	}
+
+	return mapRecipeNode(node), nil
+}
+
+// findRecipeNode searches a decoded JSON-LD document for a node typed Recipe
+func findRecipeNode(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if node := findRecipeNode(item); node != nil {
+				return node
+			}
+		}
+	case map[string]interface{}:
+		if hasType(v, "Recipe") {
+			return v
+		}
+		if graph, ok := v["@graph"]; ok {
+			return findRecipeNode(graph)
+		}
+	}
+	return nil
+}
+
+// hasType reports whether a node's @type is (or includes) the given type
+func hasType(node map[string]interface{}, typeName string) bool {
+	for _, t := range stringValues(node["@type"]) {
+		if t == typeName || strings.HasSuffix(t, "/"+typeName) {
+			return true
+		}
+	}
+	return false
+}
+
+// mapRecipeNode converts a schema.org Recipe node to a models.Recipe
+func mapRecipeNode(node map[string]interface{}) *ImportResult {
+	result := &ImportResult{
+		Unmapped: []string{},
+		Missing:  []string{},
+	}
+	recipe := &result.Recipe
+	mapped := map[string]bool{"@context": true, "@type": true, "@id": true}
+
+	if name := firstString(node["name"]); name != "" {
+		recipe.Name = name
+		mapped["name"] = true
+	}
+
+	ingredientsKey := "recipeIngredient"
+	if _, ok := node[ingredientsKey]; !ok {
+		ingredientsKey = "ingredients" // deprecated schema.org property
+	}
+	for _, ingredient := range stringValues(node[ingredientsKey]) {
+		if ingredient = cleanText(ingredient); ingredient != "" {
+			recipe.Ingredients = append(recipe.Ingredients, ingredient)
+		}
+	}
+	if len(recipe.Ingredients) > 0 {
+		mapped[ingredientsKey] = true
+	}
+
+	if steps := instructionSteps(node["recipeInstructions"]); len(steps) > 0 {
+		if len(steps) == 1 {
+			recipe.Instructions = steps[0]
+		} else {
+			lines := make([]string, len(steps))
+			for i, step := range steps {
+				lines[i] = fmt.Sprintf("%d. %s", i+1, step)
+			}
+			recipe.Instructions = strings.Join(lines, "\n")
+		}
+		mapped["recipeInstructions"] = true
+	}
+
+	if total, ok := totalTime(node); ok {
+		recipe.CookingTime = FormatCookingTime(total)
+		mapped["totalTime"] = true
+		if _, ok := node["totalTime"]; !ok {
+			mapped["prepTime"] = true
+			mapped["cookTime"] = true
+		}
+	}
+
+	for _, yield := range stringValues(node["recipeYield"]) {
+		if number := firstNumberPattern.FindString(yield); number != "" {
+			if servings, err := strconv.Atoi(number); err == nil && servings > 0 {
+				recipe.Servings = servings
+				mapped["recipeYield"] = true
+				break
+			}
+		}
+	}
+
+	if category := firstString(node["recipeCategory"]); category != "" {
+		recipe.Category = strings.ToLower(category)
+		mapped["recipeCategory"] = true
+	}
+
+	for key := range node {
+		if !mapped[key] {
+			result.Unmapped = append(result.Unmapped, key)
+		}
+	}
+	sort.Strings(result.Unmapped)
+
+	required := []struct {
+		field string
+		empty bool
+	}{
+		{"name", recipe.Name == ""},
+		{"ingredients", len(recipe.Ingredients) == 0},
+		{"instructions", recipe.Instructions == ""},
+		{"cooking_time", recipe.CookingTime == ""},
+		{"servings", recipe.Servings == 0},
+		{"category", recipe.Category == ""},
+	}
+	for _, r := range required {
+		if r.empty {
+			result.Missing = append(result.Missing, r.field)
+		}
+	}
+
+	return result
+}
+
+// instructionSteps flattens recipeInstructions given as a string, a list of
+// strings, HowToStep nodes or HowToSection nodes
+func instructionSteps(value interface{}) []string {
+	var steps []string
+	switch v := value.(type) {
+	case string:
+		if text := cleanText(v); text != "" {
+			steps = append(steps, text)
+		}
+	case []interface{}:
+		for _, item := range v {
+			steps = append(steps, instructionSteps(item)...)
+		}
+	case map[string]interface{}:
+		if elements, ok := v["itemListElement"]; ok {
+			return instructionSteps(elements)
+		}
+		if text := firstString(v["text"]); text != "" {
+			steps = append(steps, text)
+		} else if name := firstString(v["name"]); name != "" {
+			steps = append(steps, name)
+		}
+	}
+	return steps
+}
+
+// totalTime returns totalTime, or prepTime plus cookTime when totalTime is absent
+func totalTime(node map[string]interface{}) (time.Duration, bool) {
+	if value := firstString(node["totalTime"]); value != "" {
+		d, err := ParseISODuration(value)
+		return d, err == nil
+	}
+
+	var total time.Duration
+	found := false
+	for _, key := range []string{"prepTime", "cookTime"} {
+		if value := firstString(node[key]); value != "" {
+			d, err := ParseISODuration(value)
+			if err != nil {
+				return 0, false
+			}
+			total += d
+			found = true
+		}
+	}
+	return total, found
+}
+
+// stringValues returns the string, number or list-of-strings values of a property
+func stringValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			values = append(values, stringValues(item)...)
+		}
+		return values
+	}
+	return nil
+}
+
+// firstString returns the first non-empty cleaned string value of a property
+func firstString(value interface{}) string {
+	for _, s := range stringValues(value) {
+		if s = cleanText(s); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// cleanText unescapes HTML entities and trims whitespace
+func cleanText(s string) string {
+	return strings.TrimSpace(html.UnescapeString(s))
+}
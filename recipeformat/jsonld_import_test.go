@@ -0,0 +1,148 @@
+package recipeformat
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestImportDocument(t *testing.T) {
+	tests := []struct {
+		name         string
+		document     string
+		want         importedFields
+		wantUnmapped []string
+		wantMissing  []string
+		wantErr      error
+	}{
+		{
+			name: "complete recipe",
+			document: `{
+				"@context": "https://schema.org",
+				"@type": "Recipe",
+				"name": "Tomato Soup",
+				"recipeIngredient": ["4 tomatoes", " 1 onion ", ""],
+				"recipeInstructions": [
+					{"@type": "HowToStep", "text": "Chop."},
+					{"@type": "HowToStep", "text": "Simmer &amp; blend."}
+				],
+				"totalTime": "PT1H15M",
+				"recipeYield": ["4", "4 bowls"],
+				"recipeCategory": "Soup",
+				"author": "Someone"
+			}`,
+			want: importedFields{
+				Name:         "Tomato Soup",
+				Ingredients:  []string{"4 tomatoes", "1 onion"},
+				Instructions: "1. Chop.\n2. Simmer & blend.",
+				CookingTime:  "1 hour 15 minutes",
+				Servings:     4,
+				Category:     "soup",
+			},
+			wantUnmapped: []string{"author"},
+			wantMissing:  []string{},
+		},
+		{
+			name: "recipe in an @graph with prep and cook times",
+			document: `{"@graph": [
+				{"@type": "WebPage", "name": "Page"},
+				{"@type": ["Thing", "http://schema.org/Recipe"], "name": "Toast",
+				 "ingredients": ["bread"], "recipeInstructions": "Toast the bread.",
+				 "prepTime": "PT2M", "cookTime": "PT3M", "recipeYield": 1, "recipeCategory": "Breakfast"}
+			]}`,
+			want: importedFields{
+				Name:         "Toast",
+				Ingredients:  []string{"bread"},
+				Instructions: "Toast the bread.",
+				CookingTime:  "5 minutes",
+				Servings:     1,
+				Category:     "breakfast",
+			},
+			wantUnmapped: []string{},
+			wantMissing:  []string{},
+		},
+		{
+			name: "sections are flattened and missing fields reported",
+			document: `[{"@type": "Recipe", "name": "Salad",
+				"recipeInstructions": [{"@type": "HowToSection", "itemListElement": [
+					{"@type": "HowToStep", "name": "Wash."}, "Toss."
+				]}],
+				"totalTime": "soon"}]`,
+			want: importedFields{
+				Name:         "Salad",
+				Instructions: "1. Wash.\n2. Toss.",
+			},
+			wantUnmapped: []string{"totalTime"},
+			wantMissing:  []string{"ingredients", "cooking_time", "servings", "category"},
+		},
+		{
+			name: "HTML page with a JSON-LD block",
+			document: `<html><head>
+				<script type="application/ld+json">{"@type": "Organization"}</script>
+				<script type='application/ld+json'>{"@type": "Recipe", "name": "Tea"}</script>
+			</head></html>`,
+			want:         importedFields{Name: "Tea"},
+			wantUnmapped: []string{},
+			wantMissing:  []string{"ingredients", "instructions", "cooking_time", "servings", "category"},
+		},
+		{
+			name:     "no recipe node",
+			document: `{"@type": "Person", "name": "Chef"}`,
+			wantErr:  ErrNoRecipe,
+		},
+		{
+			name:     "HTML page without a recipe",
+			document: `<html><body>No recipe here</body></html>`,
+			wantErr:  ErrNoRecipe,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ImportDocument([]byte(tt.document))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ImportDocument() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ImportDocument() error = %v", err)
+			}
+
+			got := importedFields{
+				Name:         result.Recipe.Name,
+				Ingredients:  result.Recipe.Ingredients,
+				Instructions: result.Recipe.Instructions,
+				CookingTime:  result.Recipe.CookingTime,
+				Servings:     result.Recipe.Servings,
+				Category:     result.Recipe.Category,
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ImportDocument() recipe = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(result.Unmapped, tt.wantUnmapped) {
+				t.Errorf("ImportDocument() unmapped = %v, want %v", result.Unmapped, tt.wantUnmapped)
+			}
+			if !reflect.DeepEqual(result.Missing, tt.wantMissing) {
+				t.Errorf("ImportDocument() missing = %v, want %v", result.Missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestImportJSONLDInvalid(t *testing.T) {
+	if _, err := ImportJSONLD([]byte(`{"@type": "Recipe"`)); err == nil || errors.Is(err, ErrNoRecipe) {
+		t.Errorf("ImportJSONLD() error = %v, want an invalid JSON-LD error", err)
+	}
+}
+
+// importedFields holds the recipe fields an import fills in
+type importedFields struct {
+	Name         string
+	Ingredients  []string
+	Instructions string
+	CookingTime  string
+	Servings     int
+	Category     string
+}
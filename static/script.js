@@ -1,5 +1,5 @@
 // API Base URL
-const API_BASE = '/api/recipes';
+const API_BASE = '/api/v1/recipes';
 
 // Global variables
 let currentEditingId = null;
@@ -167,8 +167,7 @@ async function handleFormSubmit(e) {
         let response;
         if (currentEditingId) {
             // Update existing recipe
-            recipeData.id = currentEditingId;
-            response = await fetch(API_BASE, {
+            response = await fetch(`${API_BASE}/${currentEditingId}`, {
                 method: 'PUT',
                 headers: {
                     'Content-Type': 'application/json',
@@ -314,7 +313,7 @@ async function handleLogout() {
     }
 
     try {
-        const response = await fetch('/api/logout', {
+        const response = await fetch('/api/v1/logout', {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
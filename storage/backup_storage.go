@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"recipe-api/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Backup archive identification
+const (
+	BackupFormat        = "recipe-api-backup"
+	BackupFormatVersion = 1
+)
+
+// unusablePasswordHash replaces password hashes left out of a backup for users
+// that are not already in the database; it never matches a bcrypt comparison
+// so those users must have their password reset
+const unusablePasswordHash = "!"
+
+// backupTable describes a table included in backups
+type backupTable struct {
+	name    string
+	orderBy string
+}
+
+// backupTables lists the backed-up tables in restore order, parents before
+// the tables that reference them. duplicate_candidates is left out as the
+// duplicate detection job rebuilds it, and idempotency_keys as it only
+// matters for a few hours.
+var backupTables = []backupTable{
+	{"users", "id"},
+	{"recipes", "created_at, id"},
+	{"pantry_items", "id"},
+	{"share_links", "created_at, id"},
+}
+
+// serialTables lists tables whose id sequence must be reset after a restore
+var serialTables = []string{"users", "pantry_items"}
+
+// backupLine is a single row line of a backup archive
+type backupLine struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// PostgresBackupStorage dumps and restores the whole database as a
+// gzip-compressed JSON-lines archive: a models.BackupHeader line followed by
+// one line per table row.
+type PostgresBackupStorage struct {
+	db *sql.DB
+}
+
+// NewPostgresBackupStorage creates a new PostgreSQL backup storage instance.
+// Dumps and restores run for as long as they need, so unlike the other
+// storages it takes no query timeout.
+func NewPostgresBackupStorage(db *sql.DB) *PostgresBackupStorage {
+	return &PostgresBackupStorage{
+		db: db,
+	}
+}
+
+// Dump writes a backup archive of every backed-up table to w. The rows are
+// read in one repeatable-read transaction so the archive is consistent.
+func (pbs *PostgresBackupStorage) Dump(ctx context.Context, w io.Writer, schemaVersion uint, opts models.BackupOptions) error {
+	tx, err := pbs.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	gz := gzip.NewWriter(w)
+	encoder := json.NewEncoder(gz)
+
+	header := models.BackupHeader{
+		Format:                 BackupFormat,
+		FormatVersion:          BackupFormatVersion,
+		SchemaVersion:          schemaVersion,
+		CreatedAt:              time.Now().UTC(),
+		IncludesPasswordHashes: opts.IncludePasswordHashes,
+	}
+	for _, table := range backupTables {
+		header.Tables = append(header.Tables, table.name)
+	}
+	if err := encoder.Encode(header); err != nil {
+		return fmt.Errorf("failed to write backup header: %w", err)
+	}
+
+	for _, table := range backupTables {
+		row := "to_jsonb(t)"
+		if table.name == "users" && !opts.IncludePasswordHashes {
+			row = "to_jsonb(t) - 'password_hash'"
+		}
+		query := fmt.Sprintf(`SELECT %s FROM %s t ORDER BY %s`, row, table.name, table.orderBy)
+
+		if err := pbs.dumpTable(ctx, tx, encoder, table.name, query); err != nil {
+			return err
+		}
+	}
+
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to finish backup archive: %w", err)
+	}
+
+	return nil
+}
+
+// dumpTable writes one archive line per row returned by query
+func (pbs *PostgresBackupStorage) dumpTable(ctx context.Context, tx *sql.Tx, encoder *json.Encoder, table, query string) error {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row []byte
+		if err := rows.Scan(&row); err != nil {
+			return fmt.Errorf("failed to scan %s row: %w", table, err)
+		}
+		if err := encoder.Encode(backupLine{Table: table, Row: row}); err != nil {
+			return fmt.Errorf("failed to write %s row: %w", table, err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating %s: %w", table, err)
+	}
+
+	return nil
+}
+
+// invalidArchive returns the ValidationError for a backup archive that
+// cannot be restored
+func invalidArchive(format string, args ...interface{}) error {
+	return &ValidationError{Fields: []models.FieldError{{Field: "archive", Message: fmt.Sprintf(format, args...)}}}
+}
+
+// readFailure returns the error for a failure to read a backup archive: a
+// ValidationError if the archive is corrupt or truncated, otherwise err
+// wrapped, as when the request body could not be read
+func readFailure(err error) error {
+	var corrupt flate.CorruptInputError
+	if errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) || errors.As(err, &corrupt) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, bufio.ErrTooLong) {
+		return invalidArchive("not a readable gzip-compressed backup archive: %v", err)
+	}
+	return fmt.Errorf("failed to read backup archive: %w", err)
+}
+
+// Restore replaces the contents of every backed-up table with the rows in a
+// backup archive, in a single transaction. The archive must have been taken
+// at the same schema version the database is migrated to. Users backed up
+// without a password hash keep the hash of the user with the same username
+// already in the database, if there is one; a restore that would leave no
+// active administrator able to log in is refused. Archives that are
+// corrupt, of another format or schema version, or hold rows the database
+// rejects are reported with a ValidationError.
+func (pbs *PostgresBackupStorage) Restore(ctx context.Context, r io.Reader, schemaVersion uint) (*models.RestoreSummary, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, readFailure(err)
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, readFailure(err)
+		}
+		return nil, invalidArchive("missing header")
+	}
+
+	var header models.BackupHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, invalidArchive("invalid header: %v", err)
+	}
+	if header.Format != BackupFormat {
+		return nil, invalidArchive("not a recipe-api backup archive")
+	}
+	if header.FormatVersion != BackupFormatVersion {
+		return nil, invalidArchive("unsupported backup format version %d (expected %d)", header.FormatVersion, BackupFormatVersion)
+	}
+	if header.SchemaVersion != schemaVersion {
+		return nil, invalidArchive("backup was taken at schema version %d but the database is at version %d", header.SchemaVersion, schemaVersion)
+	}
+
+	tables := make(map[string]bool)
+	for _, table := range backupTables {
+		tables[table.name] = true
+	}
+
+	tx, err := pbs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	hashes, err := pbs.passwordHashes(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `TRUNCATE idempotency_keys, duplicate_candidates, share_links, pantry_items, recipes, users RESTART IDENTITY CASCADE`); err != nil {
+		return nil, fmt.Errorf("failed to clear tables: %w", err)
+	}
+
+	summary := &models.RestoreSummary{
+		SchemaVersion: header.SchemaVersion,
+		CreatedAt:     header.CreatedAt,
+		Rows:          make(map[string]int),
+	}
+
+	for lineNumber := 2; scanner.Scan(); lineNumber++ {
+		var line backupLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, invalidArchive("invalid line %d: %v", lineNumber, err)
+		}
+		if !tables[line.Table] {
+			return nil, invalidArchive("invalid line %d: unknown table %q", lineNumber, line.Table)
+		}
+
+		row := []byte(line.Row)
+		if line.Table == "users" {
+			if row, err = withPasswordHash(row, hashes); err != nil {
+				return nil, invalidArchive("invalid line %d: %v", lineNumber, err)
+			}
+		}
+
+		// Table names come from backupTables, never from the archive itself
+		query := fmt.Sprintf(`INSERT INTO %[1]s SELECT * FROM jsonb_populate_record(NULL::%[1]s, $1)`, line.Table)
+		if _, err := tx.ExecContext(ctx, query, string(row)); err != nil {
+			if isRowRejected(err) {
+				return nil, invalidArchive("line %d: %s row was rejected by the database", lineNumber, line.Table)
+			}
+			return nil, fmt.Errorf("failed to restore %s row on line %d: %w", line.Table, lineNumber, err)
+		}
+		summary.Rows[line.Table]++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, readFailure(err)
+	}
+
+	var adminCanLogIn bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM users WHERE is_admin AND is_active AND password_hash <> $1)`,
+		unusablePasswordHash,
+	).Scan(&adminCanLogIn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check restored administrators: %w", err)
+	}
+	if !adminCanLogIn {
+		return nil, invalidArchive("no active administrator could log in after this restore; " +
+			"restore a backup that includes password hashes, or one with an administrator who already exists here")
+	}
+
+	for _, table := range serialTables {
+		query := fmt.Sprintf(
+			`SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE((SELECT MAX(id) FROM %[1]s), 0) + 1, false)`,
+			table)
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return nil, fmt.Errorf("failed to reset %s id sequence: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit restore: %w", err)
+	}
+
+	return summary, nil
+}
+
+// isRowRejected reports whether err is PostgreSQL refusing a row for its
+// contents, a data exception or an integrity constraint violation, rather
+// than a failure of the database
+func isRowRejected(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	class := pqErr.Code.Class()
+	return class == "22" || class == "23"
+}
+
+// passwordHashes returns the password hash of every user currently in the
+// database by username, to carry over to users restored without one
+func (pbs *PostgresBackupStorage) passwordHashes(ctx context.Context, tx *sql.Tx) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT username, password_hash FROM users`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query password hashes: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var username, hash string
+		if err := rows.Scan(&username, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan password hash: %w", err)
+		}
+		hashes[username] = hash
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating password hashes: %w", err)
+	}
+
+	return hashes, nil
+}
+
+// withPasswordHash fills in the password hash of a user row backed up
+// without one: the hash in hashes for its username, or an unusable one
+func withPasswordHash(row []byte, hashes map[string]string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(row, &fields); err != nil {
+		return nil, err
+	}
+	if hash, ok := fields["password_hash"]; ok && string(hash) != "null" {
+		return row, nil
+	}
+
+	var username string
+	if err := json.Unmarshal(fields["username"], &username); err != nil {
+		return nil, fmt.Errorf("invalid username: %v", err)
+	}
+
+	hash, ok := hashes[username]
+	if !ok {
+		hash = unusablePasswordHash
+	}
+	fields["password_hash"], _ = json.Marshal(hash)
+	return json.Marshal(fields)
+}
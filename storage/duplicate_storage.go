@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"recipe-api/models"
+	"time"
+)
+
+// PostgresDuplicateStorage handles PostgreSQL operations for the duplicate
+// candidates found by the duplicate detection job
+type PostgresDuplicateStorage struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewPostgresDuplicateStorage creates a new PostgreSQL duplicate storage instance
+func NewPostgresDuplicateStorage(db *sql.DB, queryTimeout time.Duration) *PostgresDuplicateStorage {
+	return &PostgresDuplicateStorage{
+		db:           db,
+		queryTimeout: queryTimeout,
+	}
+}
+
+// GetRecipesForScan retrieves every recipe regardless of visibility, for the
+// duplicate detection job only
+func (pds *PostgresDuplicateStorage) GetRecipesForScan(ctx context.Context) ([]models.Recipe, error) {
+	ctx, cancel := withQueryTimeout(ctx, pds.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + recipeColumns + `
+		FROM recipes r
+		ORDER BY r.created_at
+	`
+
+	rows, err := pds.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recipes: %w", err)
+	}
+	defer rows.Close()
+
+	recipes := []models.Recipe{}
+	for rows.Next() {
+		var recipe models.Recipe
+		if err := scanRecipe(rows, &recipe); err != nil {
+			return nil, fmt.Errorf("failed to scan recipe: %w", err)
+		}
+		recipes = append(recipes, recipe)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating recipes: %w", err)
+	}
+
+	return recipes, nil
+}
+
+// ReplaceDuplicateCandidates replaces all stored candidates with the result of
+// a new detection run, in a single transaction
+func (pds *PostgresDuplicateStorage) ReplaceDuplicateCandidates(ctx context.Context, candidates []models.DuplicateCandidate) error {
+	ctx, cancel := withQueryTimeout(ctx, pds.queryTimeout)
+	defer cancel()
+
+	tx, err := pds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM duplicate_candidates`); err != nil {
+		return fmt.Errorf("failed to clear duplicate candidates: %w", err)
+	}
+
+	// Recipes deleted since the scan started are skipped rather than failing the run
+	query := `
+		INSERT INTO duplicate_candidates (recipe_id, duplicate_id, score, detected_at)
+		SELECT $1, $2, $3, $4
+		WHERE EXISTS (SELECT 1 FROM recipes WHERE id = $1)
+		  AND EXISTS (SELECT 1 FROM recipes WHERE id = $2)
+	`
+	for _, candidate := range candidates {
+		_, err := tx.ExecContext(ctx, query, candidate.RecipeID, candidate.DuplicateID, candidate.Score, candidate.DetectedAt)
+		if err != nil {
+			return fmt.Errorf("failed to save duplicate candidate: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit duplicate candidates: %w", err)
+	}
+
+	return nil
+}
+
+// GetDuplicateCandidates retrieves the candidate pairs where both recipes are
+// visible to the user, most similar first
+func (pds *PostgresDuplicateStorage) GetDuplicateCandidates(ctx context.Context, userID *int) ([]models.DuplicateCandidate, error) {
+	ctx, cancel := withQueryTimeout(ctx, pds.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT dc.recipe_id, r.name, dc.duplicate_id, d.name, dc.score, dc.detected_at
+		FROM duplicate_candidates dc
+		JOIN recipes r ON r.id = dc.recipe_id
+		JOIN recipes d ON d.id = dc.duplicate_id
+		WHERE ` + visibleTo(1) + `
+		  AND ` + visibleToAs("d", 1) + `
+		ORDER BY dc.score DESC, dc.detected_at DESC
+	`
+
+	rows, err := pds.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query duplicate candidates: %w", err)
+	}
+	defer rows.Close()
+
+	candidates := []models.DuplicateCandidate{}
+	for rows.Next() {
+		var candidate models.DuplicateCandidate
+		err := rows.Scan(
+			&candidate.RecipeID, &candidate.RecipeName, &candidate.DuplicateID, &candidate.DuplicateName,
+			&candidate.Score, &candidate.DetectedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan duplicate candidate: %w", err)
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating duplicate candidates: %w", err)
+	}
+
+	return candidates, nil
+}
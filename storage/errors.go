@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"recipe-api/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrVersionMismatch is returned by a versioned write when the record has
+// been changed by someone else since that version was read
+var ErrVersionMismatch = errors.New("recipe has been modified since it was read")
+
+// ErrForbidden is returned by a write to a record the user can see but may
+// not change, such as a recipe shared with them by someone else
+var ErrForbidden = errors.New("not allowed to change this record")
+
+// ErrNotFound matches every NotFoundError with errors.Is
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict matches every ConflictError with errors.Is
+var ErrConflict = errors.New("already exists")
+
+// ErrInvalidCredentials is returned when a username and password do not
+// match an active user. It does not say which of the two was wrong.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// NotFoundError is returned when a record does not exist or is not visible
+// to the user asking for it. Field names the key it was looked up by and
+// defaults to ID.
+type NotFoundError struct {
+	Resource string
+	Field    string
+	ID       string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s with %s %s not found", e.Resource, fieldOrID(e.Field), e.ID)
+}
+
+// Is makes errors.Is(err, ErrNotFound) true for every NotFoundError
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// ConflictError is returned when a write clashes with a record that already
+// exists, such as a second user with the same username. Field names the
+// clashing key and defaults to ID.
+type ConflictError struct {
+	Resource string
+	Field    string
+	ID       string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s with %s %s already exists", e.Resource, fieldOrID(e.Field), e.ID)
+}
+
+// Is makes errors.Is(err, ErrConflict) true for every ConflictError
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// fieldOrID returns field, or "ID" if it is empty
+func fieldOrID(field string) string {
+	if field == "" {
+		return "ID"
+	}
+	return field
+}
+
+// ValidationError is returned when a record is rejected before being
+// written. Fields says what is wrong with which field.
+type ValidationError struct {
+	Fields []models.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	return "validation failed: " + models.FieldErrors(e.Fields).Error()
+}
+
+// validate runs a model's Validate method, turning the field errors it
+// reports into a ValidationError
+func validate(model interface{ Validate() error }) error {
+	err := model.Validate()
+	if err == nil {
+		return nil
+	}
+
+	var fieldErrors models.FieldErrors
+	if errors.As(err, &fieldErrors) {
+		return &ValidationError{Fields: fieldErrors}
+	}
+	return &ValidationError{Fields: []models.FieldError{{Message: err.Error()}}}
+}
+
+// PostgreSQL error codes for constraint violations
+const (
+	pqForeignKeyViolation = "23503"
+	pqUniqueViolation     = "23505"
+)
+
+// pqQueryCanceled is the PostgreSQL error code for a statement cancelled by
+// the server, as happens when a query's context expires mid-statement
+const pqQueryCanceled = "57014"
+
+// PostgreSQL error codes meaning the server cannot serve requests right now
+var pqUnavailableCodes = map[string]bool{
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// IsUnavailable reports whether err means the database could not be
+// reached, as opposed to a query failing: a refused or broken connection,
+// or a server that is shutting down or out of connections
+func IsUnavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+
+	var netErr *net.OpError
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 covers every kind of connection exception
+		return pqErr.Code.Class() == "08" || pqUnavailableCodes[string(pqErr.Code)]
+	}
+	return false
+}
+
+// IsTimeout reports whether err means a storage call ran out of time, either
+// the per-query timeout or the deadline of the request it served
+func IsTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || hasPQCode(err, pqQueryCanceled)
+}
+
+// hasPQCode reports whether err is a PostgreSQL error with the given code
+func hasPQCode(err error, code string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && string(pqErr.Code) == code
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"recipe-api/models"
+	"sync/atomic"
+	"time"
+)
+
+// PostgresIdempotencyStorage handles PostgreSQL operations for idempotency
+// keys. Keys are scoped to the user that sent them and forgotten once older
+// than the configured window. A key whose request never finished, as when
+// the server stopped while serving it, is forgotten once the request
+// timeout has passed.
+type PostgresIdempotencyStorage struct {
+	db             *sql.DB
+	queryTimeout   time.Duration
+	window         atomic.Int64
+	pendingTimeout atomic.Int64
+}
+
+// NewPostgresIdempotencyStorage creates a new PostgreSQL idempotency storage
+// instance that keeps keys for the given window and in-progress keys for
+// pendingTimeout, the request timeout; 0 keeps those for the window too.
+func NewPostgresIdempotencyStorage(db *sql.DB, queryTimeout, window, pendingTimeout time.Duration) *PostgresIdempotencyStorage {
+	pis := &PostgresIdempotencyStorage{
+		db:           db,
+		queryTimeout: queryTimeout,
+	}
+	pis.SetWindow(window)
+	pis.SetPendingTimeout(pendingTimeout)
+	return pis
+}
+
+// SetWindow changes how long keys are kept
+func (pis *PostgresIdempotencyStorage) SetWindow(window time.Duration) {
+	pis.window.Store(int64(window))
+}
+
+// SetPendingTimeout changes how long keys whose request has not finished are
+// kept
+func (pis *PostgresIdempotencyStorage) SetPendingTimeout(timeout time.Duration) {
+	pis.pendingTimeout.Store(int64(timeout))
+}
+
+// expiryTimes returns the creation times before which completed and
+// in-progress keys have expired
+func (pis *PostgresIdempotencyStorage) expiryTimes() (completed, pending time.Time) {
+	now := time.Now()
+	completed = now.Add(-time.Duration(pis.window.Load()))
+	pending = completed
+	if timeout := time.Duration(pis.pendingTimeout.Load()); timeout > 0 {
+		pending = now.Add(-timeout)
+	}
+	return completed, pending
+}
+
+// expiredCondition matches keys created before $n, or before $n+1 if their
+// request has not finished
+func expiredCondition(placeholder int) string {
+	return fmt.Sprintf(`(created_at < $%d OR (status_code IS NULL AND created_at < $%d))`, placeholder, placeholder+1)
+}
+
+// maxReserveAttempts bounds how often ReserveIdempotencyKey retries a key
+// that other requests keep reserving and releasing
+const maxReserveAttempts = 3
+
+// ReserveIdempotencyKey claims a key for a new request. It returns nil if the
+// key was free (or had expired, or its request was cut off) and is now
+// reserved, or the record stored by the earlier request that used it. A key
+// that keeps changing hands is reported as a ConflictError.
+func (pis *PostgresIdempotencyStorage) ReserveIdempotencyKey(ctx context.Context, userID int, key, requestHash string) (*models.IdempotencyRecord, error) {
+	ctx, cancel := withQueryTimeout(ctx, pis.queryTimeout)
+	defer cancel()
+
+	completed, pending := pis.expiryTimes()
+	_, err := pis.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND `+expiredCondition(3),
+		userID, key, completed, pending,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire idempotency key: %w", err)
+	}
+
+	// The earlier request may fail and release the key between the insert and
+	// the select, in which case the key is free to be reserved again
+	for attempt := 0; attempt < maxReserveAttempts; attempt++ {
+		result, err := pis.db.ExecContext(ctx, `
+			INSERT INTO idempotency_keys (user_id, key, request_hash)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, key) DO NOTHING
+		`, userID, key, requestHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		if rowsAffected == 1 {
+			return nil, nil
+		}
+
+		query := `
+			SELECT user_id, key, request_hash, COALESCE(status_code, 0), COALESCE(etag, ''),
+			       COALESCE(content_type, ''), response_body, created_at
+			FROM idempotency_keys
+			WHERE user_id = $1 AND key = $2
+		`
+
+		var record models.IdempotencyRecord
+		err = pis.db.QueryRowContext(ctx, query, userID, key).Scan(
+			&record.UserID, &record.Key, &record.RequestHash, &record.StatusCode, &record.ETag,
+			&record.ContentType, &record.ResponseBody, &record.CreatedAt,
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+
+		return &record, nil
+	}
+
+	return nil, &ConflictError{Resource: "idempotency key", ID: key}
+}
+
+// CompleteIdempotencyKey stores the response of the request holding a key
+func (pis *PostgresIdempotencyStorage) CompleteIdempotencyKey(ctx context.Context, record models.IdempotencyRecord) error {
+	ctx, cancel := withQueryTimeout(ctx, pis.queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $3, etag = NULLIF($4, ''), content_type = NULLIF($5, ''), response_body = $6
+		WHERE user_id = $1 AND key = $2
+	`
+
+	_, err := pis.db.ExecContext(ctx, query,
+		record.UserID, record.Key, record.StatusCode, record.ETag, record.ContentType, record.ResponseBody)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets a key whose request failed, so that a retry
+// is processed afresh
+func (pis *PostgresIdempotencyStorage) ReleaseIdempotencyKey(ctx context.Context, userID int, key string) error {
+	ctx, cancel := withQueryTimeout(ctx, pis.queryTimeout)
+	defer cancel()
+
+	_, err := pis.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2`, userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes keys older than the window, and
+// in-progress keys older than the request timeout, and returns how many
+// were removed
+func (pis *PostgresIdempotencyStorage) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx, pis.queryTimeout)
+	defer cancel()
+
+	completed, pending := pis.expiryTimes()
+	result, err := pis.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE `+expiredCondition(1), completed, pending)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -1,23 +1,80 @@
 package storage
 
-import "recipe-api/models"
+import (
+	"context"
+	"io"
+	"recipe-api/models"
+)
 
-// RecipeStorage defines the interface for recipe storage operations
+// RecipeStorage defines the interface for recipe storage operations.
+// Every method takes the context of the request it serves; storage calls are
+// cancelled with it and are also bounded by the configured query timeout.
+// userID identifies the user making the request; only recipes visible to
+// that user are read, and only recipes they own, or any recipe for an
+// administrator, are modified. A nil userID sees public recipes only.
+// Writes to a recipe the user can see but not change fail with ErrForbidden.
+// Writes given a non-zero version fail with ErrVersionMismatch if the recipe
+// has changed since that version was read. Recipes that do not exist or are
+// not visible are reported with a NotFoundError, matching ErrNotFound.
 type RecipeStorage interface {
-	GetAllRecipes() ([]models.Recipe, error)
-	GetRecipeByID(id string) (*models.Recipe, error)
-	SaveRecipe(recipe models.Recipe, userID *int) error
-	DeleteRecipe(id string) error
-	GetRecipesByCategory(category string) ([]models.Recipe, error)
-	SearchRecipes(searchTerm string) ([]models.Recipe, error)
+	GetAllRecipes(ctx context.Context, userID *int) ([]models.Recipe, error)
+	StreamRecipes(ctx context.Context, userID *int, fn func(recipe models.Recipe) error) error
+	GetRecipeByID(ctx context.Context, id string, userID *int) (*models.Recipe, error)
+	GetPublicRecipeByID(ctx context.Context, id string) (*models.Recipe, error)
+	SaveRecipe(ctx context.Context, recipe models.Recipe, userID *int) error
+	UpdateRecipe(ctx context.Context, recipe models.Recipe, userID *int) error
+	UpdateRecipeFields(ctx context.Context, recipe models.Recipe, fields []string, userID *int) error
+	ImportRecipes(ctx context.Context, recipes []models.Recipe, userID *int) error
+	DeleteRecipe(ctx context.Context, id string, version int, userID *int) error
+	GetRecipesByCategory(ctx context.Context, category string, userID *int) ([]models.Recipe, error)
+	SearchRecipes(ctx context.Context, searchTerm string, userID *int) ([]models.Recipe, error)
+	ForkRecipe(ctx context.Context, id string, userID *int) (*models.Recipe, error)
+	GetForks(ctx context.Context, id string, userID *int) ([]models.Recipe, error)
+	MergeRecipe(ctx context.Context, targetID, sourceID string, userID *int) (*models.Recipe, error)
 }
 
 // UserStorage defines the interface for user storage operations
 type UserStorage interface {
-	GetUserByUsername(username string) (*models.User, error)
-	GetUserByID(id int) (*models.User, error)
-	CreateUser(user models.User) error
-	UpdateUser(user models.User) error
-	DeleteUser(id int) error
-	ValidateCredentials(username, password string) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	GetUserByID(ctx context.Context, id int) (*models.User, error)
+	CreateUser(ctx context.Context, user models.User) error
+	UpdateUser(ctx context.Context, user models.User) error
+	DeleteUser(ctx context.Context, id int) error
+	ValidateCredentials(ctx context.Context, username, password string) (*models.User, error)
+}
+
+// PantryStorage defines the interface for pantry storage operations
+type PantryStorage interface {
+	GetPantryItems(ctx context.Context, userID int) ([]models.PantryItem, error)
+	SavePantryItem(ctx context.Context, item *models.PantryItem) error
+	DeletePantryItem(ctx context.Context, id, userID int) error
+}
+
+// ShareLinkStorage defines the interface for recipe share link operations
+type ShareLinkStorage interface {
+	CreateShareLink(ctx context.Context, link *models.ShareLink) error
+	GetShareLinks(ctx context.Context, recipeID string) ([]models.ShareLink, error)
+	RevokeShareLink(ctx context.Context, id, recipeID string) error
+	GetRecipeByShareLink(ctx context.Context, linkID string) (*models.Recipe, error)
+}
+
+// DuplicateStorage defines the interface for duplicate detection operations
+type DuplicateStorage interface {
+	GetRecipesForScan(ctx context.Context) ([]models.Recipe, error)
+	ReplaceDuplicateCandidates(ctx context.Context, candidates []models.DuplicateCandidate) error
+	GetDuplicateCandidates(ctx context.Context, userID *int) ([]models.DuplicateCandidate, error)
+}
+
+// IdempotencyStorage defines the interface for idempotency key operations
+type IdempotencyStorage interface {
+	ReserveIdempotencyKey(ctx context.Context, userID int, key, requestHash string) (*models.IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, record models.IdempotencyRecord) error
+	ReleaseIdempotencyKey(ctx context.Context, userID int, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+}
+
+// BackupStorage defines the interface for whole-database backup operations
+type BackupStorage interface {
+	Dump(ctx context.Context, w io.Writer, schemaVersion uint, opts models.BackupOptions) error
+	Restore(ctx context.Context, r io.Reader, schemaVersion uint) (*models.RestoreSummary, error)
 }
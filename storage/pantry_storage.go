@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"recipe-api/models"
+	"strconv"
+	"time"
+)
+
+// PostgresPantryStorage handles PostgreSQL operations for pantry items
+type PostgresPantryStorage struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewPostgresPantryStorage creates a new PostgreSQL pantry storage instance
+func NewPostgresPantryStorage(db *sql.DB, queryTimeout time.Duration) *PostgresPantryStorage {
+	return &PostgresPantryStorage{
+		db:           db,
+		queryTimeout: queryTimeout,
+	}
+}
+
+// GetPantryItems retrieves all pantry items belonging to a user
+func (pps *PostgresPantryStorage) GetPantryItems(ctx context.Context, userID int) ([]models.PantryItem, error) {
+	ctx, cancel := withQueryTimeout(ctx, pps.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, ingredient, quantity, expires_at, created_at, updated_at
+		FROM pantry_items
+		WHERE user_id = $1
+		ORDER BY ingredient
+	`
+
+	rows, err := pps.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pantry items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.PantryItem{}
+	for rows.Next() {
+		var item models.PantryItem
+		err := rows.Scan(
+			&item.ID, &item.UserID, &item.Ingredient, &item.Quantity, &item.ExpiresAt,
+			&item.CreatedAt, &item.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pantry item: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pantry items: %w", err)
+	}
+
+	return items, nil
+}
+
+// SavePantryItem adds an item to a user's pantry. Adding an ingredient that is
+// already in the pantry, by models.NormalizeIngredient, replaces its quantity
+// and expiry. Items that fail validation are rejected with a ValidationError.
+func (pps *PostgresPantryStorage) SavePantryItem(ctx context.Context, item *models.PantryItem) error {
+	ctx, cancel := withQueryTimeout(ctx, pps.queryTimeout)
+	defer cancel()
+
+	if err := validate(item); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO pantry_items (user_id, ingredient, ingredient_key, quantity, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, ingredient_key)
+		DO UPDATE SET quantity = EXCLUDED.quantity, expires_at = EXCLUDED.expires_at
+		RETURNING id, created_at, updated_at
+	`
+
+	err := pps.db.QueryRowContext(ctx,
+		query,
+		item.UserID, item.Ingredient, models.NormalizeIngredient(item.Ingredient), item.Quantity, item.ExpiresAt,
+	).Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to save pantry item: %w", err)
+	}
+
+	return nil
+}
+
+// KeyLegacyItems fills in the ingredient_key of pantry items saved before it
+// existed, and returns how many items were merged away. Items of one user
+// that normalize to the same key are merged with models.MergePantryItems
+// into the item already keyed, or else the most recently updated one.
+func (pps *PostgresPantryStorage) KeyLegacyItems(ctx context.Context) (int, error) {
+	tx, err := pps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Keyed items come first in each user's list, then the newest unkeyed
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, user_id, ingredient, quantity, expires_at, COALESCE(ingredient_key, '')
+		FROM pantry_items
+		WHERE user_id IN (SELECT user_id FROM pantry_items WHERE ingredient_key IS NULL)
+		ORDER BY user_id, ingredient_key IS NULL, updated_at DESC, id DESC
+		FOR UPDATE
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query unkeyed pantry items: %w", err)
+	}
+
+	type pantryKey struct {
+		userID int
+		key    string
+	}
+	groups := make(map[pantryKey][]models.PantryItem)
+	keyed := make(map[int]bool)
+	var order []pantryKey
+	for rows.Next() {
+		var item models.PantryItem
+		var key string
+		if err := rows.Scan(&item.ID, &item.UserID, &item.Ingredient, &item.Quantity, &item.ExpiresAt, &key); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan pantry item: %w", err)
+		}
+		if key != "" {
+			keyed[item.ID] = true
+		} else {
+			key = models.NormalizeIngredient(item.Ingredient)
+		}
+		group := pantryKey{item.UserID, key}
+		if groups[group] == nil {
+			order = append(order, group)
+		}
+		groups[group] = append(groups[group], item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating pantry items: %w", err)
+	}
+
+	merged := 0
+	for _, group := range order {
+		items := groups[group]
+		if len(items) == 1 && keyed[items[0].ID] {
+			continue
+		}
+
+		for _, duplicate := range items[1:] {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM pantry_items WHERE id = $1`, duplicate.ID); err != nil {
+				return 0, fmt.Errorf("failed to merge pantry item: %w", err)
+			}
+		}
+		merged += len(items) - 1
+
+		item := models.MergePantryItems(items)
+		_, err := tx.ExecContext(ctx, `
+			UPDATE pantry_items
+			SET ingredient_key = $2, quantity = $3, expires_at = $4,
+			    updated_at = CASE WHEN $5 THEN CURRENT_TIMESTAMP ELSE updated_at END
+			WHERE id = $1
+		`, item.ID, group.key, item.Quantity, item.ExpiresAt, len(items) > 1)
+		if err != nil {
+			return 0, fmt.Errorf("failed to key pantry item: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit pantry keys: %w", err)
+	}
+
+	return merged, nil
+}
+
+// DeletePantryItem removes an item from a user's pantry
+func (pps *PostgresPantryStorage) DeletePantryItem(ctx context.Context, id, userID int) error {
+	ctx, cancel := withQueryTimeout(ctx, pps.queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM pantry_items WHERE id = $1 AND user_id = $2`
+
+	result, err := pps.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete pantry item: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return &NotFoundError{Resource: "pantry item", ID: strconv.Itoa(id)}
+	}
+
+	return nil
+}
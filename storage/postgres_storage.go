@@ -1,239 +1,733 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"recipe-api/database"
 	"recipe-api/models"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 )
 
+// recipeColumns lists the columns selected for a recipe, in scanRecipe order.
+// Queries must alias the recipes table as r.
+const recipeColumns = `
+		r.id, r.name, r.ingredients, r.instructions, r.cooking_time, r.servings, r.category,
+		r.visibility,
+		ARRAY(SELECT u.username FROM users u WHERE u.id = ANY(r.shared_with_users) ORDER BY u.username),
+		r.shared_with_groups,
+		r.forked_from, (SELECT COUNT(*) FROM recipes f WHERE f.forked_from = r.id),
+		r.version,
+		r.created_at, r.updated_at, r.created_by, r.updated_by`
+
+// visibleTo returns a condition matching recipes the user bound to the given
+// placeholder may see: public recipes, their own, and recipes shared with
+// them directly or through one of their groups. A NULL user sees only public
+// recipes.
+func visibleTo(placeholder int) string {
+	return visibleToAs("r", placeholder)
+}
+
+// visibleToAs is visibleTo for a recipes table aliased as alias
+func visibleToAs(alias string, placeholder int) string {
+	return fmt.Sprintf(`(%[2]s.visibility = 'public'
+		OR %[2]s.created_by = $%[1]d
+		OR (%[2]s.visibility = 'shared' AND ($%[1]d = ANY(%[2]s.shared_with_users)
+			OR %[2]s.shared_with_groups && (SELECT g.groups FROM users g WHERE g.id = $%[1]d))))`, placeholder, alias)
+}
+
+// writableBy returns a condition matching recipes the user bound to the
+// given placeholder may change: their own, or any recipe if they are an
+// administrator. Seeing a recipe through visibleTo does not make it writable.
+func writableBy(placeholder int) string {
+	return fmt.Sprintf(`(r.created_by = $%[1]d
+		OR EXISTS (SELECT 1 FROM users a WHERE a.id = $%[1]d AND a.is_admin))`, placeholder)
+}
+
+// queryRower is implemented by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// withQueryTimeout bounds a storage call by the storage's query timeout, on
+// top of any deadline ctx already carries. A zero timeout leaves ctx as is.
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRecipe scans a row selected with recipeColumns
+func scanRecipe(row rowScanner, recipe *models.Recipe) error {
+	return row.Scan(
+		&recipe.ID, &recipe.Name, pq.Array(&recipe.Ingredients), &recipe.Instructions,
+		&recipe.CookingTime, &recipe.Servings, &recipe.Category,
+		&recipe.Visibility, pq.Array(&recipe.SharedWithUsers), pq.Array(&recipe.SharedWithGroups),
+		&recipe.ForkedFrom, &recipe.ForkCount,
+		&recipe.Version,
+		&recipe.CreatedAt, &recipe.UpdatedAt, &recipe.CreatedBy, &recipe.UpdatedBy,
+	)
+}
+
 // PostgresStorage handles PostgreSQL operations for recipes
 type PostgresStorage struct {
-	db *sql.DB
+	db           *sql.DB
+	queryTimeout time.Duration
 }
 
-// NewPostgresStorage creates a new PostgreSQL storage instance
-func NewPostgresStorage() *PostgresStorage {
+// NewPostgresStorage creates a new PostgreSQL storage instance on db. Each
+// storage call is bounded by queryTimeout; 0 means no bound.
+func NewPostgresStorage(db *sql.DB, queryTimeout time.Duration) *PostgresStorage {
 	return &PostgresStorage{
-		db: database.GetDB(),
+		db:           db,
+		queryTimeout: queryTimeout,
 	}
 }
 
-// GetAllRecipes retrieves all recipes from the database
-func (ps *PostgresStorage) GetAllRecipes() ([]models.Recipe, error) {
+// GetAllRecipes retrieves all recipes visible to the user
+func (ps *PostgresStorage) GetAllRecipes(ctx context.Context, userID *int) (recipes []models.Recipe, err error) {
+	ctx, op := startOperation(ctx, "GetAllRecipes")
+	defer func() { op.end(len(recipes), err) }()
+	ctx, cancel := withQueryTimeout(ctx, ps.queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT id, name, ingredients, instructions, cooking_time, servings, category,
-		       created_at, updated_at, created_by, updated_by
-		FROM recipes
-		ORDER BY created_at DESC
+		SELECT ` + recipeColumns + `
+		FROM recipes r
+		WHERE ` + visibleTo(1) + `
+		ORDER BY r.created_at DESC
 	`
 
-	rows, err := ps.db.Query(query)
+	rows, err := ps.db.QueryContext(ctx, query, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query recipes: %v", err)
+		return nil, fmt.Errorf("failed to query recipes: %w", err)
+	}
+	defer rows.Close()
+
+	return ps.scanRecipes(rows)
+}
+
+// StreamRecipes calls fn for each recipe visible to the user, in creation
+// order, without loading them all into memory. Iteration stops at the first
+// error returned by fn.
+func (ps *PostgresStorage) StreamRecipes(ctx context.Context, userID *int, fn func(recipe models.Recipe) error) (err error) {
+	ctx, op := startOperation(ctx, "StreamRecipes")
+	streamed := 0
+	defer func() { op.end(streamed, err) }()
+
+	query := `
+		SELECT ` + recipeColumns + `
+		FROM recipes r
+		WHERE ` + visibleTo(1) + `
+		ORDER BY r.created_at
+	`
+
+	rows, err := ps.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to query recipes: %w", err)
 	}
 	defer rows.Close()
 
-	var recipes []models.Recipe
 	for rows.Next() {
 		var recipe models.Recipe
-		err := rows.Scan(
-			&recipe.ID, &recipe.Name, pq.Array(&recipe.Ingredients), &recipe.Instructions,
-			&recipe.CookingTime, &recipe.Servings, &recipe.Category,
-			&recipe.CreatedAt, &recipe.UpdatedAt, &recipe.CreatedBy, &recipe.UpdatedBy,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan recipe: %v", err)
+		if err := scanRecipe(rows, &recipe); err != nil {
+			return fmt.Errorf("failed to scan recipe: %w", err)
 		}
-		recipes = append(recipes, recipe)
+		if err := fn(recipe); err != nil {
+			return err
+		}
+		streamed++
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating recipes: %v", err)
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating recipes: %w", err)
 	}
 
-	return recipes, nil
+	return nil
+}
+
+// GetRecipeByID retrieves a specific recipe by ID if it is visible to the user
+func (ps *PostgresStorage) GetRecipeByID(ctx context.Context, id string, userID *int) (_ *models.Recipe, err error) {
+	ctx, op := startOperation(ctx, "GetRecipeByID")
+	defer func() { op.end(countRows(err), err) }()
+	return ps.getRecipeByID(ctx, id, userID)
+}
+
+// GetPublicRecipeByID retrieves a recipe by ID only if it is public
+func (ps *PostgresStorage) GetPublicRecipeByID(ctx context.Context, id string) (_ *models.Recipe, err error) {
+	ctx, op := startOperation(ctx, "GetPublicRecipeByID")
+	defer func() { op.end(countRows(err), err) }()
+	return ps.getRecipeByID(ctx, id, nil)
 }
 
-// GetRecipeByID retrieves a specific recipe by ID
-func (ps *PostgresStorage) GetRecipeByID(id string) (*models.Recipe, error) {
+// getRecipeByID retrieves a recipe by ID if it is visible to the user, or
+// only if it is public when userID is nil. It is not instrumented itself, so
+// each caller is counted and traced as its own operation.
+func (ps *PostgresStorage) getRecipeByID(ctx context.Context, id string, userID *int) (*models.Recipe, error) {
+	ctx, cancel := withQueryTimeout(ctx, ps.queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT id, name, ingredients, instructions, cooking_time, servings, category,
-		       created_at, updated_at, created_by, updated_by
-		FROM recipes
-		WHERE id = $1
+		SELECT ` + recipeColumns + `
+		FROM recipes r
+		WHERE r.id = $1 AND ` + visibleTo(2) + `
 	`
 
 	var recipe models.Recipe
-	err := ps.db.QueryRow(query, id).Scan(
-		&recipe.ID, &recipe.Name, pq.Array(&recipe.Ingredients), &recipe.Instructions,
-		&recipe.CookingTime, &recipe.Servings, &recipe.Category,
-		&recipe.CreatedAt, &recipe.UpdatedAt, &recipe.CreatedBy, &recipe.UpdatedBy,
-	)
+	err := scanRecipe(ps.db.QueryRowContext(ctx, query, id, userID), &recipe)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("recipe with ID %s not found", id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundError{Resource: "recipe", ID: id}
 		}
-		return nil, fmt.Errorf("failed to get recipe: %v", err)
+		return nil, fmt.Errorf("failed to get recipe: %w", err)
 	}
 
 	return &recipe, nil
 }
 
-// SaveRecipe adds a new recipe or updates an existing one
-func (ps *PostgresStorage) SaveRecipe(recipe models.Recipe, userID *int) error {
-	// Check if recipe exists
-	existingRecipe, err := ps.GetRecipeByID(recipe.ID)
-	if err != nil && err.Error() != fmt.Sprintf("recipe with ID %s not found", recipe.ID) {
+// SaveRecipe creates a recipe, or updates it under the same rules as
+// UpdateRecipe, in a single upsert so concurrent saves cannot both insert it.
+func (ps *PostgresStorage) SaveRecipe(ctx context.Context, recipe models.Recipe, userID *int) (err error) {
+	ctx, op := startOperation(ctx, "SaveRecipe")
+	defer func() { op.end(countRows(err), err) }()
+	ctx, cancel := withQueryTimeout(ctx, ps.queryTimeout)
+	defer cancel()
+
+	if err := validate(&recipe); err != nil {
+		return err
+	}
+	if err := checkSharees(ctx, ps.db, recipe); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO recipes AS r (id, name, ingredients, instructions, cooking_time, servings, category,
+		                          visibility, shared_with_users, shared_with_groups, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $9,
+		        ARRAY(SELECT id FROM users WHERE username = ANY($10)), COALESCE($11, '{}'::text[]), $8, $8)
+		ON CONFLICT (id) DO UPDATE
+		SET name = EXCLUDED.name, ingredients = EXCLUDED.ingredients, instructions = EXCLUDED.instructions,
+		    cooking_time = EXCLUDED.cooking_time, servings = EXCLUDED.servings, category = EXCLUDED.category,
+		    updated_by = EXCLUDED.updated_by, updated_at = CURRENT_TIMESTAMP,
+		    version = r.version + 1,
+		    visibility = CASE WHEN r.created_by = $8 THEN EXCLUDED.visibility ELSE r.visibility END,
+		    shared_with_users = CASE WHEN r.created_by = $8
+		        THEN EXCLUDED.shared_with_users ELSE r.shared_with_users END,
+		    shared_with_groups = CASE WHEN r.created_by = $8
+		        THEN EXCLUDED.shared_with_groups ELSE r.shared_with_groups END
+		WHERE ($12 = 0 OR r.version = $12) AND ` + writableBy(8) + `
+		RETURNING r.updated_at
+	`
+
+	err = ps.db.QueryRowContext(ctx,
+		query,
+		recipe.ID, recipe.Name, pq.Array(recipe.Ingredients), recipe.Instructions,
+		recipe.CookingTime, recipe.Servings, recipe.Category, userID,
+		recipe.Visibility, pq.Array(recipe.SharedWithUsers), pq.Array(recipe.SharedWithGroups),
+		recipe.Version,
+	).Scan(&recipe.UpdatedAt)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// The recipe exists but the user cannot change it or it has moved on
+			return ps.missingOrModified(ctx, recipe.ID, recipe.Version, userID)
+		}
+		return fmt.Errorf("failed to save recipe: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateRecipe replaces the content of an existing recipe the user owns, or
+// of any recipe for an administrator. Unlike SaveRecipe it never creates the
+// recipe, so a recipe deleted meanwhile is reported with a NotFoundError.
+// Only the creator may change visibility and sharing, and sharing with
+// unknown users or groups is rejected with a ValidationError. A non-zero
+// recipe.Version must match the stored version.
+func (ps *PostgresStorage) UpdateRecipe(ctx context.Context, recipe models.Recipe, userID *int) (err error) {
+	ctx, op := startOperation(ctx, "UpdateRecipe")
+	defer func() { op.end(countRows(err), err) }()
+	ctx, cancel := withQueryTimeout(ctx, ps.queryTimeout)
+	defer cancel()
+
+	if err := validate(&recipe); err != nil {
+		return err
+	}
+	if err := checkSharees(ctx, ps.db, recipe); err != nil {
 		return err
 	}
 
-	if existingRecipe != nil {
-		// Update existing recipe
-		return ps.updateRecipe(recipe, userID)
-	} else {
-		// Create new recipe
-		return ps.createRecipe(recipe, userID)
+	query := `
+		UPDATE recipes r
+		SET name = $2, ingredients = $3, instructions = $4, cooking_time = $5, servings = $6, category = $7,
+		    updated_by = $8, updated_at = CURRENT_TIMESTAMP, version = r.version + 1,
+		    visibility = CASE WHEN r.created_by = $8 THEN $9 ELSE r.visibility END,
+		    shared_with_users = CASE WHEN r.created_by = $8
+		        THEN ARRAY(SELECT id FROM users WHERE username = ANY($10)) ELSE r.shared_with_users END,
+		    shared_with_groups = CASE WHEN r.created_by = $8
+		        THEN COALESCE($11, '{}'::text[]) ELSE r.shared_with_groups END
+		WHERE r.id = $1 AND ($12 = 0 OR r.version = $12) AND ` + writableBy(8) + `
+	`
+
+	result, err := ps.db.ExecContext(ctx,
+		query,
+		recipe.ID, recipe.Name, pq.Array(recipe.Ingredients), recipe.Instructions,
+		recipe.CookingTime, recipe.Servings, recipe.Category, userID,
+		recipe.Visibility, pq.Array(recipe.SharedWithUsers), pq.Array(recipe.SharedWithGroups),
+		recipe.Version,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update recipe: %w", err)
 	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ps.missingOrModified(ctx, recipe.ID, recipe.Version, userID)
+	}
+
+	return nil
 }
 
-// createRecipe creates a new recipe
-func (ps *PostgresStorage) createRecipe(recipe models.Recipe, userID *int) error {
+// createRecipe creates a new recipe using the given connection or transaction
+func (ps *PostgresStorage) createRecipe(ctx context.Context, q queryRower, recipe models.Recipe, userID *int) error {
 	// Generate new UUID if not provided
 	if recipe.ID == "" {
 		recipe.ID = uuid.New().String()
 	}
+	if err := checkSharees(ctx, q, recipe); err != nil {
+		return err
+	}
 
 	query := `
-		INSERT INTO recipes (id, name, ingredients, instructions, cooking_time, servings, category, created_by, updated_by)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO recipes (id, name, ingredients, instructions, cooking_time, servings, category,
+		                     visibility, shared_with_users, shared_with_groups, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8,
+		        ARRAY(SELECT id FROM users WHERE username = ANY($9)), COALESCE($10, '{}'::text[]), $11, $12)
 		RETURNING created_at, updated_at
 	`
 
-	err := ps.db.QueryRow(
+	err := q.QueryRowContext(ctx,
 		query,
 		recipe.ID, recipe.Name, pq.Array(recipe.Ingredients), recipe.Instructions,
-		recipe.CookingTime, recipe.Servings, recipe.Category, userID, userID,
+		recipe.CookingTime, recipe.Servings, recipe.Category,
+		recipe.Visibility, pq.Array(recipe.SharedWithUsers), pq.Array(recipe.SharedWithGroups),
+		userID, userID,
 	).Scan(&recipe.CreatedAt, &recipe.UpdatedAt)
 
 	if err != nil {
-		return fmt.Errorf("failed to create recipe: %v", err)
+		if hasPQCode(err, pqUniqueViolation) {
+			return &ConflictError{Resource: "recipe", ID: recipe.ID}
+		}
+		return fmt.Errorf("failed to create recipe: %w", err)
 	}
 
 	return nil
 }
 
-// updateRecipe updates an existing recipe
-func (ps *PostgresStorage) updateRecipe(recipe models.Recipe, userID *int) error {
-	query := `
-		UPDATE recipes 
-		SET name = $2, ingredients = $3, instructions = $4, cooking_time = $5, 
-		    servings = $6, category = $7, updated_by = $8, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $1
-		RETURNING updated_at
-	`
+// checkSharees rejects a recipe shared with users or groups that do not
+// exist, with a ValidationError naming them. A group exists while any user
+// belongs to it.
+func checkSharees(ctx context.Context, q queryRower, recipe models.Recipe) error {
+	if len(recipe.SharedWithUsers) == 0 && len(recipe.SharedWithGroups) == 0 {
+		return nil
+	}
 
-	err := ps.db.QueryRow(
-		query,
-		recipe.ID, recipe.Name, pq.Array(recipe.Ingredients), recipe.Instructions,
-		recipe.CookingTime, recipe.Servings, recipe.Category, userID,
-	).Scan(&recipe.UpdatedAt)
+	var unknownUsers, unknownGroups []string
+	err := q.QueryRowContext(ctx, `
+		SELECT ARRAY(SELECT name FROM unnest($1::text[]) name
+		             WHERE NOT EXISTS (SELECT 1 FROM users WHERE username = name)),
+		       ARRAY(SELECT name FROM unnest($2::text[]) name
+		             WHERE NOT EXISTS (SELECT 1 FROM users WHERE name = ANY(groups)))
+	`, pq.Array(recipe.SharedWithUsers), pq.Array(recipe.SharedWithGroups)).Scan(
+		pq.Array(&unknownUsers), pq.Array(&unknownGroups),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to check sharing: %w", err)
+	}
 
+	var problems []models.FieldError
+	if len(unknownUsers) > 0 {
+		problems = append(problems, models.FieldError{
+			Field:   "shared_with_users",
+			Message: "unknown users: " + strings.Join(unknownUsers, ", "),
+		})
+	}
+	if len(unknownGroups) > 0 {
+		problems = append(problems, models.FieldError{
+			Field:   "shared_with_groups",
+			Message: "unknown groups: " + strings.Join(unknownGroups, ", "),
+		})
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Fields: problems}
+	}
+	return nil
+}
+
+// ImportRecipes creates all of the given recipes in a single transaction;
+// if any insert fails none of the recipes are saved
+func (ps *PostgresStorage) ImportRecipes(ctx context.Context, recipes []models.Recipe, userID *int) (err error) {
+	ctx, op := startOperation(ctx, "ImportRecipes")
+	defer func() {
+		imported := 0
+		if err == nil {
+			imported = len(recipes)
+		}
+		op.end(imported, err)
+	}()
+	ctx, cancel := withQueryTimeout(ctx, ps.queryTimeout)
+	defer cancel()
+
+	tx, err := ps.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to update recipe: %v", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, recipe := range recipes {
+		if err := ps.createRecipe(ctx, tx, recipe, userID); err != nil {
+			return fmt.Errorf("recipe %d (%s): %w", i+1, recipe.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit import: %w", err)
 	}
 
 	return nil
 }
 
-// DeleteRecipe removes a recipe by ID
-func (ps *PostgresStorage) DeleteRecipe(id string) error {
-	query := `DELETE FROM recipes WHERE id = $1`
+// recipeFieldUpdates maps each patchable recipe field to its SET expression,
+// with %s standing for the placeholder, and the value bound to it
+var recipeFieldUpdates = map[string]struct {
+	expr  string
+	value func(recipe models.Recipe) interface{}
+}{
+	"name":         {"name = %s", func(r models.Recipe) interface{} { return r.Name }},
+	"ingredients":  {"ingredients = %s", func(r models.Recipe) interface{} { return pq.Array(r.Ingredients) }},
+	"instructions": {"instructions = %s", func(r models.Recipe) interface{} { return r.Instructions }},
+	"cooking_time": {"cooking_time = %s", func(r models.Recipe) interface{} { return r.CookingTime }},
+	"servings":     {"servings = %s", func(r models.Recipe) interface{} { return r.Servings }},
+	"category":     {"category = %s", func(r models.Recipe) interface{} { return r.Category }},
+	"visibility":   {"visibility = %s", func(r models.Recipe) interface{} { return r.Visibility }},
+	"shared_with_users": {"shared_with_users = ARRAY(SELECT id FROM users WHERE username = ANY(%s))",
+		func(r models.Recipe) interface{} { return pq.Array(r.SharedWithUsers) }},
+	"shared_with_groups": {"shared_with_groups = COALESCE(%s, '{}'::text[])",
+		func(r models.Recipe) interface{} { return pq.Array(r.SharedWithGroups) }},
+}
+
+// UpdateRecipeFields writes only the given fields of a recipe under the same
+// rules as UpdateRecipe; models.SharingFields are written only by the creator.
+func (ps *PostgresStorage) UpdateRecipeFields(ctx context.Context, recipe models.Recipe, fields []string, userID *int) (err error) {
+	ctx, op := startOperation(ctx, "UpdateRecipeFields")
+	defer func() { op.end(countRows(err), err) }()
+	ctx, cancel := withQueryTimeout(ctx, ps.queryTimeout)
+	defer cancel()
+
+	if len(fields) == 0 {
+		return nil
+	}
+	if err := validate(&recipe); err != nil {
+		return err
+	}
+
+	args := []interface{}{recipe.ID, userID, recipe.Version}
+	sets := []string{"updated_by = $2", "updated_at = CURRENT_TIMESTAMP", "version = r.version + 1"}
+	ownerOnly := false
+	for _, field := range fields {
+		update, ok := recipeFieldUpdates[field]
+		if !ok {
+			return fmt.Errorf("unknown recipe field %s", field)
+		}
+		args = append(args, update.value(recipe))
+		sets = append(sets, fmt.Sprintf(update.expr, fmt.Sprintf("$%d", len(args))))
+		for _, sharingField := range models.SharingFields {
+			if field == sharingField {
+				ownerOnly = true
+			}
+		}
+	}
 
-	result, err := ps.db.Exec(query, id)
+	condition := writableBy(2)
+	if ownerOnly {
+		if err := checkSharees(ctx, ps.db, recipe); err != nil {
+			return err
+		}
+		condition = "r.created_by = $2"
+	}
+	query := `UPDATE recipes r SET ` + strings.Join(sets, ", ") +
+		` WHERE r.id = $1 AND ($3 = 0 OR r.version = $3) AND ` + condition
+
+	result, err := ps.db.ExecContext(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("failed to delete recipe: %v", err)
+		return fmt.Errorf("failed to update recipe: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
+		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("recipe with ID %s not found", id)
+		return ps.missingOrModified(ctx, recipe.ID, recipe.Version, userID)
 	}
 
 	return nil
 }
 
-// GetRecipesByCategory retrieves recipes by category
-func (ps *PostgresStorage) GetRecipesByCategory(category string) ([]models.Recipe, error) {
+// DeleteRecipe removes a recipe by ID if the user owns it or is an
+// administrator. A non-zero version must match the stored version.
+func (ps *PostgresStorage) DeleteRecipe(ctx context.Context, id string, version int, userID *int) (err error) {
+	ctx, op := startOperation(ctx, "DeleteRecipe")
+	defer func() { op.end(countRows(err), err) }()
+	ctx, cancel := withQueryTimeout(ctx, ps.queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM recipes r WHERE r.id = $1 AND ($3 = 0 OR r.version = $3) AND ` + writableBy(2)
+
+	result, err := ps.db.ExecContext(ctx, query, id, userID, version)
+	if err != nil {
+		return fmt.Errorf("failed to delete recipe: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ps.missingOrModified(ctx, id, version, userID)
+	}
+
+	return nil
+}
+
+// missingOrModified explains why a write to a recipe matched no rows:
+// ErrForbidden if the user can see the recipe but not change it,
+// ErrVersionMismatch if they can change it but it is at another version,
+// otherwise a NotFoundError
+func (ps *PostgresStorage) missingOrModified(ctx context.Context, id string, version int, userID *int) error {
+	var current int
+	var writable bool
+	query := `SELECT r.version, ` + writableBy(2) + ` FROM recipes r WHERE r.id = $1 AND ` + visibleTo(2)
+	err := ps.db.QueryRowContext(ctx, query, id, userID).Scan(&current, &writable)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return &NotFoundError{Resource: "recipe", ID: id}
+	case err != nil:
+		return fmt.Errorf("failed to check recipe: %w", err)
+	case !writable:
+		return ErrForbidden
+	case version != 0 && current != version:
+		return ErrVersionMismatch
+	}
+
+	return &NotFoundError{Resource: "recipe", ID: id}
+}
+
+// ForkRecipe copies a recipe visible to the user into a new private recipe
+// owned by that user, recording the original in forked_from
+func (ps *PostgresStorage) ForkRecipe(ctx context.Context, id string, userID *int) (_ *models.Recipe, err error) {
+	ctx, op := startOperation(ctx, "ForkRecipe")
+	defer func() { op.end(countRows(err), err) }()
+	ctx, cancel := withQueryTimeout(ctx, ps.queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT id, name, ingredients, instructions, cooking_time, servings, category,
-		       created_at, updated_at, created_by, updated_by
-		FROM recipes
-		WHERE category = $1
-		ORDER BY created_at DESC
+		INSERT INTO recipes (id, name, ingredients, instructions, cooking_time, servings, category,
+		                     visibility, forked_from, created_by, updated_by)
+		SELECT $3::uuid, r.name, r.ingredients, r.instructions, r.cooking_time, r.servings, r.category,
+		       'private', r.id, $2::integer, $2::integer
+		FROM recipes r
+		WHERE r.id = $1 AND ` + visibleTo(2) + `
 	`
 
-	rows, err := ps.db.Query(query, category)
+	forkID := uuid.New().String()
+	result, err := ps.db.ExecContext(ctx, query, id, userID, forkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fork recipe: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return nil, fmt.Errorf("failed to query recipes by category: %v", err)
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, &NotFoundError{Resource: "recipe", ID: id}
+	}
+
+	return ps.getRecipeByID(ctx, forkID, userID)
+}
+
+// GetForks retrieves the forks of a recipe that are visible to the user
+func (ps *PostgresStorage) GetForks(ctx context.Context, id string, userID *int) (recipes []models.Recipe, err error) {
+	ctx, op := startOperation(ctx, "GetForks")
+	defer func() { op.end(len(recipes), err) }()
+	ctx, cancel := withQueryTimeout(ctx, ps.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + recipeColumns + `
+		FROM recipes r
+		WHERE r.forked_from = $1 AND ` + visibleTo(2) + `
+		ORDER BY r.created_at DESC
+	`
+
+	rows, err := ps.db.QueryContext(ctx, query, id, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query forks: %w", err)
 	}
 	defer rows.Close()
 
-	var recipes []models.Recipe
-	for rows.Next() {
-		var recipe models.Recipe
-		err := rows.Scan(
-			&recipe.ID, &recipe.Name, pq.Array(&recipe.Ingredients), &recipe.Instructions,
-			&recipe.CookingTime, &recipe.Servings, &recipe.Category,
-			&recipe.CreatedAt, &recipe.UpdatedAt, &recipe.CreatedBy, &recipe.UpdatedBy,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan recipe: %v", err)
+	return ps.scanRecipes(rows)
+}
+
+// MergeRecipe folds the source recipe into the target and deletes the source,
+// in a single transaction. The target keeps its content but takes the older
+// of the two creation times, and forks of the source are re-pointed at it.
+// Share links of the source are revoked with it rather than moved, since they
+// were granted for the source alone. The user must be able to change the
+// target and must own the source.
+func (ps *PostgresStorage) MergeRecipe(ctx context.Context, targetID, sourceID string, userID *int) (_ *models.Recipe, err error) {
+	ctx, op := startOperation(ctx, "MergeRecipe")
+	defer func() { op.end(countRows(err), err) }()
+	ctx, cancel := withQueryTimeout(ctx, ps.queryTimeout)
+	defer cancel()
+
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the source so it cannot change or gain forks while being merged
+	var sourceCreatedAt time.Time
+	err = tx.QueryRowContext(ctx,
+		`SELECT created_at FROM recipes WHERE id = $1 AND created_by = $2 FOR UPDATE`,
+		sourceID, userID,
+	).Scan(&sourceCreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundError{Resource: "recipe", ID: sourceID}
 		}
-		recipes = append(recipes, recipe)
+		return nil, fmt.Errorf("failed to get source recipe: %w", err)
 	}
 
-	return recipes, nil
+	query := `
+		UPDATE recipes r
+		SET created_at = LEAST(r.created_at, $2), updated_by = $3, updated_at = CURRENT_TIMESTAMP,
+		    version = r.version + 1
+		WHERE r.id = $1 AND ` + writableBy(3) + `
+	`
+	result, err := tx.ExecContext(ctx, query, targetID, sourceCreatedAt, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update target recipe: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, ps.missingOrModified(ctx, targetID, 0, userID)
+	}
+
+	// A target forked from the source simply loses its forked_from on delete
+	_, err = tx.ExecContext(ctx, `UPDATE recipes SET forked_from = $1 WHERE forked_from = $2 AND id <> $1`, targetID, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-point forks: %w", err)
+	}
+
+	// Share links and duplicate candidates of the source are removed by ON DELETE CASCADE
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recipes WHERE id = $1`, sourceID); err != nil {
+		return nil, fmt.Errorf("failed to delete source recipe: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit merge: %w", err)
+	}
+
+	return ps.getRecipeByID(ctx, targetID, userID)
 }
 
-// SearchRecipes searches recipes by name or ingredients
-func (ps *PostgresStorage) SearchRecipes(searchTerm string) ([]models.Recipe, error) {
+// GetRecipesByCategory retrieves recipes visible to the user by category
+func (ps *PostgresStorage) GetRecipesByCategory(ctx context.Context, category string, userID *int) (recipes []models.Recipe, err error) {
+	ctx, op := startOperation(ctx, "GetRecipesByCategory")
+	defer func() { op.end(len(recipes), err) }()
+	ctx, cancel := withQueryTimeout(ctx, ps.queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT id, name, ingredients, instructions, cooking_time, servings, category,
-		       created_at, updated_at, created_by, updated_by
-		FROM recipes
-		WHERE name ILIKE $1 OR $2 = ANY(ingredients)
-		ORDER BY created_at DESC
+		SELECT ` + recipeColumns + `
+		FROM recipes r
+		WHERE r.category = $1 AND ` + visibleTo(2) + `
+		ORDER BY r.created_at DESC
+	`
+
+	rows, err := ps.db.QueryContext(ctx, query, category, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recipes by category: %w", err)
+	}
+	defer rows.Close()
+
+	return ps.scanRecipes(rows)
+}
+
+// SearchRecipes searches recipes visible to the user by name or ingredients
+func (ps *PostgresStorage) SearchRecipes(ctx context.Context, searchTerm string, userID *int) (recipes []models.Recipe, err error) {
+	ctx, op := startOperation(ctx, "SearchRecipes")
+	defer func() { op.end(len(recipes), err) }()
+	ctx, cancel := withQueryTimeout(ctx, ps.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + recipeColumns + `
+		FROM recipes r
+		WHERE (r.name ILIKE $1 OR $2 = ANY(r.ingredients)) AND ` + visibleTo(3) + `
+		ORDER BY r.created_at DESC
 	`
 
 	searchPattern := "%" + searchTerm + "%"
-	rows, err := ps.db.Query(query, searchPattern, searchTerm)
+	rows, err := ps.db.QueryContext(ctx, query, searchPattern, searchTerm, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search recipes: %v", err)
+		return nil, fmt.Errorf("failed to search recipes: %w", err)
 	}
 	defer rows.Close()
 
+	return ps.scanRecipes(rows)
+}
+
+// scanRecipes reads all rows selected with recipeColumns
+func (ps *PostgresStorage) scanRecipes(rows *sql.Rows) ([]models.Recipe, error) {
 	var recipes []models.Recipe
 	for rows.Next() {
 		var recipe models.Recipe
-		err := rows.Scan(
-			&recipe.ID, &recipe.Name, pq.Array(&recipe.Ingredients), &recipe.Instructions,
-			&recipe.CookingTime, &recipe.Servings, &recipe.Category,
-			&recipe.CreatedAt, &recipe.UpdatedAt, &recipe.CreatedBy, &recipe.UpdatedBy,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan recipe: %v", err)
+		if err := scanRecipe(rows, &recipe); err != nil {
+			return nil, fmt.Errorf("failed to scan recipe: %w", err)
 		}
 		recipes = append(recipes, recipe)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating recipes: %w", err)
+	}
+
 	return recipes, nil
 }
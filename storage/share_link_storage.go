@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"recipe-api/models"
+	"time"
+)
+
+// PostgresShareLinkStorage handles PostgreSQL operations for recipe share links
+type PostgresShareLinkStorage struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewPostgresShareLinkStorage creates a new PostgreSQL share link storage instance
+func NewPostgresShareLinkStorage(db *sql.DB, queryTimeout time.Duration) *PostgresShareLinkStorage {
+	return &PostgresShareLinkStorage{
+		db:           db,
+		queryTimeout: queryTimeout,
+	}
+}
+
+// CreateShareLink stores a new share link and fills in its ID and creation time
+func (pss *PostgresShareLinkStorage) CreateShareLink(ctx context.Context, link *models.ShareLink) error {
+	ctx, cancel := withQueryTimeout(ctx, pss.queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO share_links (recipe_id, expires_at, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	err := pss.db.QueryRowContext(ctx, query, link.RecipeID, link.ExpiresAt, link.CreatedBy).Scan(&link.ID, &link.CreatedAt)
+	if err != nil {
+		if hasPQCode(err, pqForeignKeyViolation) {
+			return &NotFoundError{Resource: "recipe", ID: link.RecipeID}
+		}
+		return fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	return nil
+}
+
+// GetShareLinks retrieves the outstanding (not revoked, not expired) links for a recipe
+func (pss *PostgresShareLinkStorage) GetShareLinks(ctx context.Context, recipeID string) ([]models.ShareLink, error) {
+	ctx, cancel := withQueryTimeout(ctx, pss.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, recipe_id, expires_at, revoked_at, created_at, created_by
+		FROM share_links
+		WHERE recipe_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY created_at DESC
+	`
+
+	rows, err := pss.db.QueryContext(ctx, query, recipeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query share links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		var link models.ShareLink
+		err := rows.Scan(
+			&link.ID, &link.RecipeID, &link.ExpiresAt, &link.RevokedAt, &link.CreatedAt, &link.CreatedBy,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share link: %w", err)
+		}
+		links = append(links, link)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating share links: %w", err)
+	}
+
+	return links, nil
+}
+
+// RevokeShareLink marks a recipe's share link as revoked
+func (pss *PostgresShareLinkStorage) RevokeShareLink(ctx context.Context, id, recipeID string) error {
+	ctx, cancel := withQueryTimeout(ctx, pss.queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE share_links SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND recipe_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := pss.db.ExecContext(ctx, query, id, recipeID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return &NotFoundError{Resource: "share link", ID: id}
+	}
+
+	return nil
+}
+
+// GetRecipeByShareLink retrieves the recipe an active share link points to,
+// regardless of the recipe's visibility
+func (pss *PostgresShareLinkStorage) GetRecipeByShareLink(ctx context.Context, linkID string) (*models.Recipe, error) {
+	ctx, cancel := withQueryTimeout(ctx, pss.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + recipeColumns + `
+		FROM share_links sl
+		JOIN recipes r ON r.id = sl.recipe_id
+		WHERE sl.id = $1 AND sl.revoked_at IS NULL AND sl.expires_at > CURRENT_TIMESTAMP
+	`
+
+	var recipe models.Recipe
+	err := scanRecipe(pss.db.QueryRowContext(ctx, query, linkID), &recipe)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundError{Resource: "share link", ID: linkID}
+		}
+		return nil, fmt.Errorf("failed to get shared recipe: %w", err)
+	}
+
+	return &recipe, nil
+}
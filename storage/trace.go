@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"recipe-api/metrics"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of storage operations
+var tracer = otel.Tracer("recipe-api/storage")
+
+// operation is a storage call being timed and traced
+type operation struct {
+	name  string
+	start time.Time
+	span  trace.Span
+}
+
+// startOperation starts timing the storage call name and opens its span as
+// a child of the span in ctx, which it returns a context for
+func startOperation(ctx context.Context, name string) (context.Context, *operation) {
+	ctx, span := tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(name)))
+	return ctx, &operation{name: name, start: time.Now(), span: span}
+}
+
+// end records the call's duration and ends its span, noting how many rows
+// it read or wrote and the error it returned. Errors that describe the
+// request rather than a failure, such as a missing record, do not mark the
+// span as failed.
+func (op *operation) end(rows int, err error) {
+	metrics.ObserveQuery(op.name, op.start)
+
+	op.span.SetAttributes(attribute.Int("db.rows", rows))
+	if err != nil {
+		op.span.RecordError(err)
+		if !isRequestError(err) {
+			op.span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	op.span.End()
+}
+
+// isRequestError reports whether err is one of the errors storage returns
+// for a request it cannot carry out, rather than a failure of the database
+func isRequestError(err error) bool {
+	var invalid *ValidationError
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) ||
+		errors.Is(err, ErrVersionMismatch) || errors.Is(err, ErrInvalidCredentials) ||
+		errors.Is(err, ErrForbidden) ||
+		errors.As(err, &invalid)
+}
+
+// countRows returns 1 if a single-record call succeeded and 0 otherwise
+func countRows(err error) int {
+	if err != nil {
+		return 0
+	}
+	return 1
+}
@@ -1,165 +1,224 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"recipe-api/database"
 	"recipe-api/models"
+	"strconv"
+	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // PostgresUserStorage handles PostgreSQL operations for users
 type PostgresUserStorage struct {
-	db *sql.DB
+	db           *sql.DB
+	queryTimeout time.Duration
 }
 
 // NewPostgresUserStorage creates a new PostgreSQL user storage instance
-func NewPostgresUserStorage() *PostgresUserStorage {
+func NewPostgresUserStorage(db *sql.DB, queryTimeout time.Duration) *PostgresUserStorage {
 	return &PostgresUserStorage{
-		db: database.GetDB(),
+		db:           db,
+		queryTimeout: queryTimeout,
 	}
 }
 
 // GetUserByUsername retrieves a user by username
-func (pus *PostgresUserStorage) GetUserByUsername(username string) (*models.User, error) {
+func (pus *PostgresUserStorage) GetUserByUsername(ctx context.Context, username string) (_ *models.User, err error) {
+	ctx, op := startOperation(ctx, "GetUserByUsername")
+	defer func() { op.end(countRows(err), err) }()
+	return pus.getUserByUsername(ctx, username)
+}
+
+// getUserByUsername retrieves an active user by username without being
+// counted or traced as an operation of its own
+func (pus *PostgresUserStorage) getUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	ctx, cancel := withQueryTimeout(ctx, pus.queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT id, username, password_hash, email, is_active, created_at, updated_at, created_by, updated_by
+		SELECT id, username, password_hash, email, is_active, is_admin, groups, created_at, updated_at, created_by, updated_by
 		FROM users
 		WHERE username = $1 AND is_active = true
 	`
 
 	var user models.User
-	err := pus.db.QueryRow(query, username).Scan(
-		&user.ID, &user.Username, &user.Password, &user.Email, &user.IsActive,
+	err := pus.db.QueryRowContext(ctx, query, username).Scan(
+		&user.ID, &user.Username, &user.Password, &user.Email, &user.IsActive, &user.IsAdmin, pq.Array(&user.Groups),
 		&user.CreatedAt, &user.UpdatedAt, &user.CreatedBy, &user.UpdatedBy,
 	)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user with username %s not found", username)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundError{Resource: "user", Field: "username", ID: username}
 		}
-		return nil, fmt.Errorf("failed to get user: %v", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	return &user, nil
 }
 
 // GetUserByID retrieves a user by ID
-func (pus *PostgresUserStorage) GetUserByID(id int) (*models.User, error) {
+func (pus *PostgresUserStorage) GetUserByID(ctx context.Context, id int) (_ *models.User, err error) {
+	ctx, op := startOperation(ctx, "GetUserByID")
+	defer func() { op.end(countRows(err), err) }()
+	ctx, cancel := withQueryTimeout(ctx, pus.queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT id, username, password_hash, email, is_active, created_at, updated_at, created_by, updated_by
+		SELECT id, username, password_hash, email, is_active, is_admin, groups, created_at, updated_at, created_by, updated_by
 		FROM users
 		WHERE id = $1 AND is_active = true
 	`
 
 	var user models.User
-	err := pus.db.QueryRow(query, id).Scan(
-		&user.ID, &user.Username, &user.Password, &user.Email, &user.IsActive,
+	err = pus.db.QueryRowContext(ctx, query, id).Scan(
+		&user.ID, &user.Username, &user.Password, &user.Email, &user.IsActive, &user.IsAdmin, pq.Array(&user.Groups),
 		&user.CreatedAt, &user.UpdatedAt, &user.CreatedBy, &user.UpdatedBy,
 	)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user with ID %d not found", id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundError{Resource: "user", ID: strconv.Itoa(id)}
 		}
-		return nil, fmt.Errorf("failed to get user: %v", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	return &user, nil
 }
 
 // CreateUser creates a new user
-func (pus *PostgresUserStorage) CreateUser(user models.User) error {
+func (pus *PostgresUserStorage) CreateUser(ctx context.Context, user models.User) (err error) {
+	ctx, op := startOperation(ctx, "CreateUser")
+	defer func() { op.end(countRows(err), err) }()
+	ctx, cancel := withQueryTimeout(ctx, pus.queryTimeout)
+	defer cancel()
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return fmt.Errorf("failed to hash password: %v", err)
+		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
 	query := `
-		INSERT INTO users (username, password_hash, email, is_active, created_by, updated_by)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO users (username, password_hash, email, is_active, groups, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, COALESCE($5, '{}'::text[]), $6, $7)
 		RETURNING id, created_at, updated_at
 	`
 
-	err = pus.db.QueryRow(
+	err = pus.db.QueryRowContext(ctx,
 		query,
-		user.Username, string(hashedPassword), user.Email, user.IsActive,
+		user.Username, string(hashedPassword), user.Email, user.IsActive, pq.Array(user.Groups),
 		user.CreatedBy, user.UpdatedBy,
 	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
-		return fmt.Errorf("failed to create user: %v", err)
+		if hasPQCode(err, pqUniqueViolation) {
+			return &ConflictError{Resource: "user", Field: "username", ID: user.Username}
+		}
+		return fmt.Errorf("failed to create user: %w", err)
 	}
 
 	return nil
 }
 
 // UpdateUser updates an existing user
-func (pus *PostgresUserStorage) UpdateUser(user models.User) error {
+func (pus *PostgresUserStorage) UpdateUser(ctx context.Context, user models.User) (err error) {
+	ctx, op := startOperation(ctx, "UpdateUser")
+	defer func() { op.end(countRows(err), err) }()
+	ctx, cancel := withQueryTimeout(ctx, pus.queryTimeout)
+	defer cancel()
+
 	query := `
 		UPDATE users 
-		SET username = $2, email = $3, is_active = $4, updated_by = $5, updated_at = CURRENT_TIMESTAMP
+		SET username = $2, email = $3, is_active = $4, groups = COALESCE($6, '{}'::text[]),
+		    updated_by = $5, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1
 		RETURNING updated_at
 	`
 
-	err := pus.db.QueryRow(
+	err = pus.db.QueryRowContext(ctx,
 		query,
-		user.ID, user.Username, user.Email, user.IsActive, user.UpdatedBy,
+		user.ID, user.Username, user.Email, user.IsActive, user.UpdatedBy, pq.Array(user.Groups),
 	).Scan(&user.UpdatedAt)
 
 	if err != nil {
-		return fmt.Errorf("failed to update user: %v", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return &NotFoundError{Resource: "user", ID: strconv.Itoa(user.ID)}
+		}
+		if hasPQCode(err, pqUniqueViolation) {
+			return &ConflictError{Resource: "user", Field: "username", ID: user.Username}
+		}
+		return fmt.Errorf("failed to update user: %w", err)
 	}
 
 	return nil
 }
 
 // DeleteUser soft deletes a user by setting is_active to false
-func (pus *PostgresUserStorage) DeleteUser(id int) error {
+func (pus *PostgresUserStorage) DeleteUser(ctx context.Context, id int) (err error) {
+	ctx, op := startOperation(ctx, "DeleteUser")
+	defer func() { op.end(countRows(err), err) }()
+	ctx, cancel := withQueryTimeout(ctx, pus.queryTimeout)
+	defer cancel()
+
 	query := `UPDATE users SET is_active = false, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
 
-	result, err := pus.db.Exec(query, id)
+	result, err := pus.db.ExecContext(ctx, query, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete user: %v", err)
+		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
+		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("user with ID %d not found", id)
+		return &NotFoundError{Resource: "user", ID: strconv.Itoa(id)}
 	}
 
 	return nil
 }
 
-// ValidateCredentials validates username and password
-func (pus *PostgresUserStorage) ValidateCredentials(username, password string) (*models.User, error) {
-	user, err := pus.GetUserByUsername(username)
+// ValidateCredentials validates username and password, returning
+// ErrInvalidCredentials if there is no such active user or the password is
+// wrong
+func (pus *PostgresUserStorage) ValidateCredentials(ctx context.Context, username, password string) (_ *models.User, err error) {
+	ctx, op := startOperation(ctx, "ValidateCredentials")
+	defer func() { op.end(countRows(err), err) }()
+	user, err := pus.getUserByUsername(ctx, username)
 	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrInvalidCredentials
+		}
 		return nil, err
 	}
 
 	// Compare password with hash
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		return nil, fmt.Errorf("invalid credentials")
+		return nil, ErrInvalidCredentials
 	}
 
 	return user, nil
 }
 
 // UpdatePassword updates user password
-func (pus *PostgresUserStorage) UpdatePassword(userID int, newPassword string, updatedBy *int) error {
+func (pus *PostgresUserStorage) UpdatePassword(ctx context.Context, userID int, newPassword string, updatedBy *int) (err error) {
+	ctx, op := startOperation(ctx, "UpdatePassword")
+	defer func() { op.end(countRows(err), err) }()
+	ctx, cancel := withQueryTimeout(ctx, pus.queryTimeout)
+	defer cancel()
+
 	// Hash new password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
-		return fmt.Errorf("failed to hash password: %v", err)
+		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
 	query := `
@@ -168,18 +227,18 @@ func (pus *PostgresUserStorage) UpdatePassword(userID int, newPassword string, u
 		WHERE id = $1
 	`
 
-	result, err := pus.db.Exec(query, userID, string(hashedPassword), updatedBy)
+	result, err := pus.db.ExecContext(ctx, query, userID, string(hashedPassword), updatedBy)
 	if err != nil {
-		return fmt.Errorf("failed to update password: %v", err)
+		return fmt.Errorf("failed to update password: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
+		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("user with ID %d not found", userID)
+		return &NotFoundError{Resource: "user", ID: strconv.Itoa(userID)}
 	}
 
 	return nil